@@ -0,0 +1,228 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Supported abort modes.
+const (
+	abortClose   = "close"
+	abortReset   = "reset"
+	abortPartial = "partial"
+)
+
+var (
+	errHijackUnsupported = errors.New("connection hijacking not supported")
+	errResetUnsupported  = errors.New("connection reset not supported")
+)
+
+type abortSpec struct {
+	mode        string
+	bytes       int
+	probability float64
+}
+
+func (s *abortSpec) UnmarshalJSON(data []byte) error {
+	abortSpec := struct {
+		Mode        string  `json:"mode"`
+		Bytes       int     `json:"bytes"`
+		Probability float64 `json:"p"`
+	}{}
+
+	if err := json.Unmarshal(data, &abortSpec); err != nil {
+		return err
+	}
+
+	s.mode = abortSpec.Mode
+	s.bytes = abortSpec.Bytes
+	s.probability = abortSpec.Probability
+
+	switch s.mode {
+	case abortClose, abortReset, abortPartial:
+
+	default:
+		return fmt.Errorf("abort mode parameter value must be one of close, reset or partial")
+	}
+
+	if s.bytes < 0 {
+		return fmt.Errorf("abort bytes parameter value must be positive")
+	}
+
+	if s.probability < 0 || s.probability > 1 {
+		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
+	}
+
+	return nil
+}
+
+func (s *abortSpec) String() string {
+	if s.mode == abortPartial && s.bytes > 0 {
+		return fmt.Sprintf("%s after %d B", s.mode, s.bytes)
+	}
+
+	return s.mode
+}
+
+func (s *spec) injectAbort(r *http.Request, rnd *rand.Rand) bool {
+	return s.abort != nil && s.sample(r, rnd, "abort", s.abort.probability)
+}
+
+// abortConnection hijacks the client connection of rw and closes it, resetting it if the abort a mode is "reset".
+// If the connection cannot be hijacked (e.g. with HTTP/2) or reset (e.g. UNIX socket), it falls back to a 502 Bad
+// Gateway error response reporting the reason in the X-Chaos-Injected-Abort header.
+func (s *spec) abortConnection(rw http.ResponseWriter, a *abortSpec) {
+	conn, err := hijack(rw)
+	if err != nil {
+		a.fallback(rw, err)
+		return
+	}
+	defer conn.Close()
+
+	if a.mode == abortReset {
+		tcpConn, ok := underlyingTCPConn(conn)
+		if !ok {
+			a.fallbackConn(conn, rw.Header(), errResetUnsupported)
+			return
+		}
+
+		// Discard unsent data and send a RST segment upon closing.
+		tcpConn.SetLinger(0)
+	}
+
+	atomic.AddUint64(&s.aborted, 1)
+}
+
+// underlyingTCPConn returns the TCP connection underlying conn, unwrapping connections such as TLS ones.
+func underlyingTCPConn(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+
+		default:
+			return nil, false
+		}
+	}
+}
+
+func (s *abortSpec) fallback(rw http.ResponseWriter, err error) {
+	rw.Header().Add("X-Chaos-Injected-Abort", fmt.Sprintf("%s (probability: %.1f, fallback: %s)",
+		s, s.probability, err))
+	http.Error(rw, "Connection aborted", http.StatusBadGateway)
+}
+
+// fallbackConn writes a 502 Bad Gateway error response with headers header to the hijacked client connection conn,
+// reporting the reason err in the X-Chaos-Injected-Abort header.
+func (s *abortSpec) fallbackConn(conn net.Conn, header http.Header, err error) {
+	body := "Connection aborted\n"
+
+	header.Add("X-Chaos-Injected-Abort", fmt.Sprintf("%s (probability: %.1f, fallback: %s)",
+		s, s.probability, err))
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Connection", "close")
+
+	res := http.Response{
+		StatusCode:    http.StatusBadGateway,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+	}
+	res.Write(conn)
+}
+
+func hijack(rw http.ResponseWriter) (net.Conn, error) {
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		return nil, errHijackUnsupported
+	}
+
+	conn, _, err := hj.Hijack()
+
+	return conn, err
+}
+
+// abortResponseWriter is a http.ResponseWriter holding the response written by the downstream handler, then sending
+// only a part of it to the client before closing the connection.
+type abortResponseWriter struct {
+	http.ResponseWriter
+
+	spec   *spec
+	abort  *abortSpec
+	status int
+	buf    bytes.Buffer
+}
+
+func newAbortResponseWriter(rw http.ResponseWriter, spec *spec, abort *abortSpec) *abortResponseWriter {
+	return &abortResponseWriter{
+		ResponseWriter: rw,
+		spec:           spec,
+		abort:          abort,
+	}
+}
+
+func (w *abortResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *abortResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.buf.Write(data)
+}
+
+// Flush is a no-op since the whole response is held until the downstream handler returned.
+func (w *abortResponseWriter) Flush() {}
+
+func (w *abortResponseWriter) finish() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	conn, err := hijack(w.ResponseWriter)
+	if err != nil {
+		w.abort.fallback(w.ResponseWriter, err)
+		finishResponse(w.ResponseWriter)
+		return
+	}
+	defer conn.Close()
+
+	body := w.buf.Bytes()
+
+	n := w.abort.bytes
+	if n == 0 || n >= len(body) {
+		n = len(body) / 2
+	}
+
+	// The response advertises the full body length, so that the client notices the response is incomplete.
+	header := w.Header().Clone()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Set("Connection", "close")
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "HTTP/1.1 %d %s\r\n", w.status, http.StatusText(w.status))
+	header.Write(&head)
+	head.WriteString("\r\n")
+
+	conn.Write(append(head.Bytes(), body[:n]...))
+	atomic.AddUint64(&w.spec.aborted, 1)
+}
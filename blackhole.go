@@ -0,0 +1,93 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Default maximum number of concurrently blackholed requests.
+const DefaultMaxBlackholed = 1000
+
+type blackholeSpec struct {
+	maxHold     time.Duration
+	probability float64
+}
+
+func (s *blackholeSpec) UnmarshalJSON(data []byte) error {
+	blackholeSpec := struct {
+		MaxHold     int     `json:"max_hold"`
+		Probability float64 `json:"p"`
+	}{}
+
+	if err := json.Unmarshal(data, &blackholeSpec); err != nil {
+		return err
+	}
+
+	s.maxHold = time.Duration(blackholeSpec.MaxHold) * time.Millisecond
+	s.probability = blackholeSpec.Probability
+
+	if s.maxHold < 0 {
+		return fmt.Errorf("blackhole max_hold parameter value must be positive")
+	}
+
+	if s.probability < 0 || s.probability > 1 {
+		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
+	}
+
+	return nil
+}
+
+func (s *blackholeSpec) String() string {
+	if s.maxHold > 0 {
+		return fmt.Sprintf("max hold %s", s.maxHold)
+	}
+
+	return "until client disconnects"
+}
+
+func (s *spec) injectBlackhole(r *http.Request, rnd *rand.Rand) bool {
+	return s.blackhole != nil && s.sample(r, rnd, "blackhole", s.blackhole.probability)
+}
+
+// blackhole holds the HTTP request r open without ever answering it, until the client disconnects or the spec
+// blackhole max hold time is reached: in this case the client connection is closed (or a "504 Gateway Timeout"
+// error is returned if it cannot be hijacked). If the maximum number of concurrently blackholed requests is reached,
+// a "503 Service Unavailable" error is returned instead.
+func (c *chaosController) blackhole(rw http.ResponseWriter, r *http.Request, s *spec) {
+	if atomic.AddInt64(&c.blackholed, 1) > atomic.LoadInt64(&c.maxBlackholed) {
+		atomic.AddInt64(&c.blackholed, -1)
+		rw.Header().Add("X-Chaos-Injected-Blackhole", fmt.Sprintf("%s (probability: %.1f, fallback: %s)",
+			s.blackhole, s.blackhole.probability, "maximum number of blackholed requests reached"))
+		http.Error(rw, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	atomic.AddInt64(&s.blackholed, 1)
+
+	defer func() {
+		atomic.AddInt64(&s.blackholed, -1)
+		atomic.AddInt64(&c.blackholed, -1)
+	}()
+
+	hold := s.blackhole.maxHold
+	if hold == 0 {
+		hold = math.MaxInt64
+	}
+
+	// The client disconnecting ends the blackhole, which is accounted separately from cancellations.
+	if _, err := sleep(r.Context(), hold); err != nil {
+		atomic.AddUint64(&s.disconnected, 1)
+		return
+	}
+
+	conn, err := hijack(rw)
+	if err != nil {
+		http.Error(rw, "Gateway Timeout", http.StatusGatewayTimeout)
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,153 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// intervalBudgetSpec represents a maximum number of injections per fixed time window, each window starting with the
+// first injection following the end of the previous one.
+type intervalBudgetSpec struct {
+	max      int64
+	interval time.Duration
+
+	sync.Mutex
+	window time.Time
+	count  int64
+}
+
+func (s *intervalBudgetSpec) UnmarshalJSON(data []byte) error {
+	budgetSpec := struct {
+		Max      int64  `json:"max"`
+		Interval string `json:"interval"`
+	}{}
+
+	if err := json.Unmarshal(data, &budgetSpec); err != nil {
+		return err
+	}
+
+	s.max = budgetSpec.Max
+
+	if s.max <= 0 {
+		return fmt.Errorf("max_injections_per_interval max parameter value must be greater than 0 ")
+	}
+
+	interval, err := time.ParseDuration(budgetSpec.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid value for max_injections_per_interval interval parameter: %s", err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("max_injections_per_interval interval parameter value must be greater than 0 ")
+	}
+	s.interval = interval
+
+	return nil
+}
+
+func (s *intervalBudgetSpec) String() string {
+	return fmt.Sprintf("%d per %s", s.max, s.interval)
+}
+
+// acquire reserves an injection in the window of time now, returning false if the window budget is exhausted. The
+// returned window must be passed to release if the reserved injection eventually didn't happen.
+func (s *intervalBudgetSpec) acquire(now time.Time) (bool, time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	if now.Sub(s.window) >= s.interval {
+		s.window = now
+		s.count = 0
+	}
+
+	if s.count >= s.max {
+		return false, s.window
+	}
+	s.count++
+
+	return true, s.window
+}
+
+func (s *intervalBudgetSpec) release(window time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.window.Equal(window) && s.count > 0 {
+		s.count--
+	}
+}
+
+// remaining returns the number of injections remaining in the window of time now, and the time until the end of the
+// window (0 if no window is in progress).
+func (s *intervalBudgetSpec) remaining(now time.Time) (int64, time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	if now.Sub(s.window) >= s.interval {
+		return s.max, 0
+	}
+
+	return s.max - s.count, s.window.Add(s.interval).Sub(now)
+}
+
+// injectionBudget represents an injection reserved against the spec injection budgets.
+type injectionBudget struct {
+	spec   *spec
+	window time.Time
+}
+
+// acquireInjection reserves an injection against the spec injection budgets at time now, returning false if one of
+// the budgets is exhausted. The reservation is enforced atomically across concurrent requests, and must be released
+// if no chaos was eventually injected.
+func (s *spec) acquireInjection(now time.Time) (*injectionBudget, bool) {
+	if s.maxInjections > 0 {
+		for {
+			n := atomic.LoadInt64(&s.injections)
+			if n >= s.maxInjections {
+				return nil, false
+			}
+
+			if atomic.CompareAndSwapInt64(&s.injections, n, n+1) {
+				break
+			}
+		}
+	} else {
+		atomic.AddInt64(&s.injections, 1)
+	}
+
+	b := injectionBudget{spec: s}
+
+	if s.intervalBudget != nil {
+		var ok bool
+
+		if ok, b.window = s.intervalBudget.acquire(now); !ok {
+			atomic.AddInt64(&s.injections, -1)
+			return nil, false
+		}
+	}
+
+	return &b, true
+}
+
+// release releases the reserved injection.
+func (b *injectionBudget) release() {
+	atomic.AddInt64(&b.spec.injections, -1)
+
+	if b.spec.intervalBudget != nil {
+		b.spec.intervalBudget.release(b.window)
+	}
+}
+
+// exhausted returns true if the spec maximum number of injections has been reached.
+func (s *spec) exhausted() bool {
+	return s.maxInjections > 0 && atomic.LoadInt64(&s.injections) >= s.maxInjections
+}
+
+// injected returns true if chaos has been injected in the response written to rw, every injection reporting the
+// targeted route in the X-Chaos-Injected-Selector response header.
+func injected(rw http.ResponseWriter) bool {
+	return rw.Header().Get("X-Chaos-Injected-Selector") != ""
+}
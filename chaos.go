@@ -2,9 +2,11 @@ package chaos
 
 import (
 	"fmt"
+	"math/rand"
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,11 +24,7 @@ type Chaos struct {
 // "unix:/var/run/http-chaos.sock").
 func NewChaos(bindAddr string) (*Chaos, error) {
 	var (
-		c = Chaos{
-			controller: &chaosController{
-				routes: make(map[string]*spec),
-			},
-		}
+		c        = Chaos{controller: newChaosController()}
 		listener net.Listener
 		err      error
 	)
@@ -52,42 +50,214 @@ func NewChaos(bindAddr string) (*Chaos, error) {
 	return &c, nil
 }
 
+// SetMaxBlackholed sets the maximum number of requests concurrently held by blackhole faults (default:
+// DefaultMaxBlackholed). Beyond this limit, blackholed requests are answered with a "503 Service Unavailable" error.
+func (c *Chaos) SetMaxBlackholed(n int) {
+	atomic.StoreInt64(&c.controller.maxBlackholed, int64(n))
+}
+
+// SetSeed sets the seed the injection decision streams of the chaos specs subsequently set without their own seed are
+// derived from (along with the spec route), making their random injection decisions reproducible. By default, each
+// chaos spec is randomly seeded.
+func (c *Chaos) SetSeed(seed int64) {
+	c.controller.Lock()
+	c.controller.seed = seed
+	c.controller.seeded = true
+	c.controller.Unlock()
+}
+
 // Handler is the middleware method implementing the standard net/http Handler interface type.
 func (c *Chaos) Handler(h http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		if c.inject(rw, r) {
-			h.ServeHTTP(rw, r)
-		}
+		c.serve(rw, r, h)
 	})
 }
 
 // ServeHTTP is the middleware method implementing the Negroni HTTP middleware Handler interface type.
 func (c *Chaos) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	if c.inject(rw, r) {
+	c.serve(rw, r, next)
+}
+
+// serve injects chaos in the processing of the HTTP request r by the next handler.
+func (c *Chaos) serve(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	spec := c.controller.lookup(r)
+
+	// Fast path: no chaos spec targets the request.
+	if spec == nil {
+		next(rw, r)
+		return
+	}
+
+	if spec.concurrency != nil {
+		atomic.AddInt64(&spec.inFlight, 1)
+		defer atomic.AddInt64(&spec.inFlight, -1)
+	}
+
+	rnd := decisionRands.Get().(*rand.Rand)
+	defer decisionRands.Put(rnd)
+
+	if rw, r, ok := c.inject(rw, r, spec, rnd); ok {
 		next(rw, r)
+		finishResponse(rw)
+	}
+}
+
+// settleInjection releases the injection reserved against the spec injection budgets if no chaos was eventually
+// injected in the response written to rw (withdrawing the decision and captures reports), and expires the spec once
+// its maximum number of injections is reached.
+func (c *Chaos) settleInjection(rw http.ResponseWriter, spec *spec, budget *injectionBudget) {
+	if !injected(rw) {
+		rw.Header().Del("X-Chaos-Injected-Seed")
+		rw.Header().Del("X-Chaos-Injected-Captures")
+		budget.release()
+		return
+	}
+
+	if spec.exhausted() {
+		c.controller.expire(spec)
 	}
 }
 
-// inject is the actual chaos injection code, it returns a booleaon value false to signal the calling handler that it
-// must not continue the middleware chain if an injected error interrupted the request processing.
-func (c *Chaos) inject(rw http.ResponseWriter, r *http.Request) (cont bool) {
-	c.controller.RLock()
-	spec, ok := c.controller.routes[r.Method+r.URL.Path]
-	c.controller.RUnlock()
-
-	if ok && (spec.until.IsZero() || time.Now().Before(spec.until)) {
-		if spec.injectDelay() {
-			rw.Header().Add("X-Chaos-Injected-Delay", fmt.Sprintf("%s (probability: %.1f)",
-				spec.delay.duration, spec.delay.probability))
+// inject is the actual chaos injection code for the spec targeting the HTTP request r, drawing the injection decisions
+// from the random number generator rnd. It returns a booleaon value false to signal the calling handler that it must
+// not continue the middleware chain if an injected error interrupted the request processing. The returned
+// http.ResponseWriter and *http.Request must be used by the next handler in place of rw and r, in order to inject
+// chaos in the response phase and to mutate the request.
+func (c *Chaos) inject(rw http.ResponseWriter, r *http.Request, spec *spec,
+	rnd *rand.Rand) (http.ResponseWriter, *http.Request, bool) {
+	now := time.Now()
+
+	if spec.active(now) {
+		budget, ok := spec.acquireInjection(now)
+		if !ok {
+			return rw, r, true
+		}
+		defer c.settleInjection(rw, spec, budget)
+
+		decision := spec.decide(rnd)
+		spec.reportDecision(rw, decision)
+
+		captures := spec.captures(r)
+		spec.reportCaptures(rw, captures)
+
+		if spec.injectRateLimit(rw, r) {
+			return rw, r, false
+		}
+
+		if !spec.injectConcurrency(rw, r) {
+			return rw, r, false
+		}
+
+		// Keep a reference to the original http.ResponseWriter, required to hijack the client connection.
+		orig := rw
+
+		if i, step := spec.sequenceStep(r); step != nil {
+			desc := fmt.Sprintf("step %d/%d: %s", i+1, len(spec.sequence.steps), step)
+
+			switch step.kind {
+			case stepError:
+				rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+				rw.Header().Add("X-Chaos-Injected-Sequence", desc)
+				step.err.write(rw, r, step.err.outcomes[0], captures)
+				return rw, r, false
+
+			case stepDelay:
+				rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+				if elapsed, err := spec.wait(r, step.delay); err != nil {
+					rw.Header().Add("X-Chaos-Injected-Sequence", fmt.Sprintf("%s (cancelled after %s)", desc, elapsed))
+					return rw, r, false
+				}
+				rw.Header().Add("X-Chaos-Injected-Sequence", desc)
+
+			case stepAbort:
+				rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+				rw.Header().Add("X-Chaos-Injected-Sequence", desc)
+				if step.abort.mode == abortPartial {
+					rw = newAbortResponseWriter(rw, spec, step.abort)
+					break
+				}
+				spec.abortConnection(orig, step.abort)
+				return rw, r, false
+			}
+		}
+
+		abort := spec.injectAbort(r, rnd)
+		if abort && spec.abort.mode == abortPartial {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			rw = newAbortResponseWriter(rw, spec, spec.abort)
+		}
+
+		if spec.injectThrottle(r, rnd) {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			rw.Header().Add("X-Chaos-Injected-Throttle", fmt.Sprintf("%s (probability: %.1f)",
+				spec.throttle, spec.throttle.probability))
+			rw = newThrottledResponseWriter(rw, r, spec)
+		}
+
+		if d, ok := spec.sampleDelay(r, rnd); ok {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+
+			if spec.delay.phase == delayBefore {
+				// The request has been cancelled during the delay, there is no point continuing its processing.
+				if elapsed, err := spec.wait(r, d); err != nil {
+					rw.Header().Add("X-Chaos-Injected-Delay", fmt.Sprintf("%s (%s, cancelled after %s)",
+						d, spec.delay.details(), elapsed.Round(time.Millisecond)))
+					return rw, r, false
+				}
+			} else {
+				rw = newDelayedResponseWriter(rw, r, spec, d)
+			}
+
+			rw.Header().Add("X-Chaos-Injected-Delay", fmt.Sprintf("%s (%s)", d, spec.delay.details()))
+		}
+
+		if spec.injectCorruption(r, rnd) {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			rw.Header().Add("X-Chaos-Injected-Corruption", fmt.Sprintf("%s (probability: %.1f)",
+				spec.corruption, spec.corruption.probability))
+			rw = newCorruptResponseWriter(rw, spec, rnd)
+		}
+
+		if spec.injectBlackhole(r, rnd) {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			c.controller.blackhole(orig, r, spec)
+			return rw, r, false
+		}
+
+		if abort && spec.abort.mode != abortPartial {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			spec.abortConnection(orig, spec.abort)
+			return rw, r, false
+		}
+
+		if outcome := spec.injectError(r, rnd); outcome != nil {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			if len(spec.err.outcomes) > 1 {
+				rw.Header().Add("X-Chaos-Injected-Error", fmt.Sprintf("%d (probability: %.1f, outcomes: %s)",
+					outcome.statusCode, spec.err.currentProbability(time.Now()), spec.err))
+			} else {
+				rw.Header().Add("X-Chaos-Injected-Error", fmt.Sprintf("%d (probability: %.1f)",
+					outcome.statusCode, spec.err.currentProbability(time.Now())))
+			}
+			spec.err.write(rw, r, outcome, captures)
+			finishResponse(rw)
+			return rw, r, false
+		}
+
+		if spec.injectRequestMutation(r, rnd) {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			rw.Header().Add("X-Chaos-Injected-Request-Mutation", fmt.Sprintf("%s (probability: %.1f)",
+				spec.requestMutation, spec.requestMutation.probability))
+			r = spec.requestMutation.mutate(r)
 		}
 
-		if ok, statusCode, msg := spec.injectError(); ok {
-			rw.Header().Add("X-Chaos-Injected-Error", fmt.Sprintf("%d (probability: %.1f)",
-				spec.err.statusCode, spec.err.probability))
-			http.Error(rw, msg, statusCode)
-			return false
+		if spec.injectResponseMutation(r, rnd) {
+			rw.Header().Set("X-Chaos-Injected-Selector", spec.target())
+			rw.Header().Add("X-Chaos-Injected-Response-Mutation", fmt.Sprintf("%s (probability: %.1f)",
+				spec.responseMutation, spec.responseMutation.probability))
+			rw = newMutatedResponseWriter(rw, spec)
 		}
 	}
 
-	return true
+	return rw, r, true
 }
@@ -2,16 +2,24 @@ package chaos
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/falzm/chaos"
 	"github.com/gorilla/mux"
 )
 
@@ -26,21 +34,30 @@ func (c *testClient) sendRequest(method, path string) (int, string, float64, err
 		return 0, "", 0.0, fmt.Errorf("error creating HTTP request: %s\n", err)
 	}
 
+	res, body, latency, err := c.do(req)
+	if err != nil {
+		return 0, "", 0.0, err
+	}
+
+	return res.StatusCode, body, latency, nil
+}
+
+func (c *testClient) do(req *http.Request) (*http.Response, string, float64, error) {
 	startTime := time.Now()
 
 	res, err := c.api.http.Do(req)
 	if err != nil {
-		return 0, "", 0.0, fmt.Errorf("error sending HTTP request: %s\n", err)
+		return nil, "", 0.0, fmt.Errorf("error sending HTTP request: %s\n", err)
 	}
 	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return 0, "", 0.0, fmt.Errorf("unable to read response body: %s", err)
+		return nil, "", 0.0, fmt.Errorf("unable to read response body: %s", err)
 	}
 	body = bytes.TrimSpace(body)
 
-	return res.StatusCode, string(body), time.Now().Sub(startTime).Seconds() * 1000, nil
+	return res, string(body), time.Now().Sub(startTime).Seconds() * 1000, nil
 }
 
 func (c *testClient) testRouteChaos(method, path string, spec *Spec, testfunc func() error) error {
@@ -71,7 +88,7 @@ func Test_Chaos(t *testing.T) {
 	apiSock := path.Join(tmpDir, "api.sock")
 	chaosSock := path.Join(tmpDir, "chaos.sock")
 
-	chaos, err := chaos.NewChaos(fmt.Sprintf("unix:%s", chaosSock))
+	chaos, err := NewChaos(fmt.Sprintf("unix:%s", chaosSock))
 	if err != nil {
 		t.Errorf("unable to bind chaos management controller UNIX socket: %s", err)
 	}
@@ -178,7 +195,1656 @@ func Test_Chaos(t *testing.T) {
 		t.FailNow()
 	}
 
-	t.Log("shutting down test server")
+	// Test route path pattern precedence
+	if err := testcli.testRouteChaos("GET", "/api/{action}", NewSpec().
+		Error(http.StatusInternalServerError, "", 1.0),
+		func() error {
+			return testcli.testRouteChaos("GET", "/api/c", NewSpec().
+				Error(http.StatusServiceUnavailable, "", 1.0),
+				func() error {
+					for path, expectedStatusCode := range map[string]int{
+						"/api/c": http.StatusServiceUnavailable,
+						"/api/d": http.StatusInternalServerError,
+					} {
+						status, _, _, err := testcli.sendRequest("GET", path)
+						if err != nil {
+							return fmt.Errorf("error sending HTTP request: %s\n", err)
+						}
 
-	server.Shutdown(nil)
+						if status != expectedStatusCode {
+							return fmt.Errorf("%s: expected status code %d but got %d", path, expectedStatusCode, status)
+						}
+					}
+
+					return nil
+				})
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test adding route chaos with invalid path regex
+	if err := testcli.chaos.AddRouteChaos("GET", "", NewSpec().
+		PathRegex("^/api/(e").
+		Error(http.StatusBadGateway, "", 1.0)); err == nil {
+		t.Errorf("route chaos test failed: expected invalid path regex error")
+		t.FailNow()
+	}
+
+	// Test route path regex selector
+	if err := testcli.chaos.AddRouteChaos("GET", "", NewSpec().
+		PathRegex("^/api/e[0-9]+$").
+		Error(http.StatusBadGateway, "", 1.0)); err != nil {
+		t.Errorf("unable to add route chaos spec: %s", err)
+		t.FailNow()
+	}
+
+	for path, expectedStatusCode := range map[string]int{
+		"/api/e1": http.StatusBadGateway,
+		"/api/ex": http.StatusOK,
+	} {
+		req, _ := http.NewRequest("GET", "http://test"+path, nil)
+
+		res, _, _, err := testcli.do(req)
+		if err != nil {
+			t.Errorf("error sending HTTP request: %s\n", err)
+			t.FailNow()
+		}
+
+		if res.StatusCode != expectedStatusCode {
+			t.Errorf("%s: expected status code %d but got %d", path, expectedStatusCode, res.StatusCode)
+		}
+
+		if res.StatusCode != http.StatusOK {
+			if selector := res.Header.Get("X-Chaos-Injected-Selector"); selector != "GET ~^/api/e[0-9]+$" {
+				t.Errorf("%s: unexpected injected selector header %q", path, selector)
+			}
+		}
+	}
+
+	if err := testcli.chaos.DeleteRouteRegexChaos("GET", "^/api/e[0-9]+$"); err != nil {
+		t.Errorf("unable to delete chaos spec from route: %s", err)
+		t.FailNow()
+	}
+
+	// Test route path regex selector named captures
+	if err := testcli.chaos.AddRouteChaos("GET", "", NewSpec().
+		PathRegex("^/api/cap(?P<id>[0-9]+)$").
+		Error(http.StatusNotFound, "", 1.0).
+		ErrorBody("", "item {{.Captures.id}} not found")); err != nil {
+		t.Errorf("unable to add route chaos spec: %s", err)
+		t.FailNow()
+	}
+
+	req, _ := http.NewRequest("GET", "http://test/api/cap42", nil)
+	res, body, _, err := testcli.do(req)
+	if err != nil {
+		t.Errorf("error sending HTTP request: %s\n", err)
+		t.FailNow()
+	}
+
+	if captures := res.Header.Get("X-Chaos-Injected-Captures"); captures != "id=42" {
+		t.Errorf("unexpected injected captures header %q", captures)
+	}
+
+	if body != "item 42 not found" {
+		t.Errorf("unexpected error body %q", body)
+	}
+
+	if err := testcli.chaos.DeleteRouteRegexChaos("GET", "^/api/cap(?P<id>[0-9]+)$"); err != nil {
+		t.Errorf("unable to delete chaos spec from route: %s", err)
+		t.FailNow()
+	}
+
+	// Test wildcard and multi-method route chaos
+	if err := testcli.testRouteChaos("*", "/api/f", NewSpec().
+		Error(http.StatusInternalServerError, "", 1.0),
+		func() error {
+			if err := testcli.chaos.AddRouteChaos("get,POST", "/api/f", NewSpec().
+				Error(http.StatusServiceUnavailable, "", 1.0)); err != nil {
+				return fmt.Errorf("unable to add route chaos spec: %s", err)
+			}
+
+			for method, expectedStatusCode := range map[string]int{
+				"GET":    http.StatusServiceUnavailable,
+				"POST":   http.StatusServiceUnavailable,
+				"DELETE": http.StatusInternalServerError,
+			} {
+				status, _, _, err := testcli.sendRequest(method, "/api/f")
+				if err != nil {
+					return fmt.Errorf("error sending HTTP request: %s\n", err)
+				}
+
+				if status != expectedStatusCode {
+					return fmt.Errorf("%s: expected status code %d but got %d", method, expectedStatusCode, status)
+				}
+			}
+
+			if err := testcli.chaos.DeleteRouteChaos("POST,GET", "/api/f"); err != nil {
+				return fmt.Errorf("unable to delete chaos spec from route: %s", err)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test request header, query and cookie matchers
+	if err := testcli.testRouteChaos("GET", "/api/g", NewSpec().
+		Error(http.StatusServiceUnavailable, "", 1.0).
+		MatchHeader("X-Canary", MatchExact("true")).
+		MatchQuery("tenant", MatchPrefix("ac")).
+		MatchCookie("session", MatchPresent()),
+		func() error {
+			for _, tc := range []struct {
+				canary             string
+				tenant             string
+				session            string
+				expectedStatusCode int
+			}{
+				{"true", "acme", "s3cr3t", http.StatusServiceUnavailable},
+				{"false", "acme", "s3cr3t", http.StatusOK},
+				{"true", "bigcorp", "s3cr3t", http.StatusOK},
+				{"true", "acme", "", http.StatusOK},
+			} {
+				req, _ := http.NewRequest("GET", "http://test/api/g?tenant="+tc.tenant, nil)
+				req.Header.Set("X-Canary", tc.canary)
+				if tc.session != "" {
+					req.AddCookie(&http.Cookie{Name: "session", Value: tc.session})
+				}
+
+				res, _, _, err := testcli.do(req)
+				if err != nil {
+					return err
+				}
+
+				if res.StatusCode != tc.expectedStatusCode {
+					return fmt.Errorf("%+v: expected status code %d but got %d", tc, tc.expectedStatusCode, res.StatusCode)
+				}
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test client source network and virtual host selectors
+	if err := testcli.testRouteChaos("GET", "/api/h", NewSpec().
+		Error(http.StatusServiceUnavailable, "", 1.0).
+		SourceCIDRs(1, "10.0.0.0/8", "192.168.1.1").
+		Hosts("*.example.net"),
+		func() error {
+			for _, tc := range []struct {
+				host               string
+				forwardedFor       string
+				expectedStatusCode int
+			}{
+				{"api.example.net", "172.16.0.1, 10.1.2.3", http.StatusServiceUnavailable},
+				{"api.example.net:8080", "192.168.1.1", http.StatusServiceUnavailable},
+				{"api.example.net", "10.1.2.3, 172.16.0.1", http.StatusOK},
+				{"api.example.org", "10.1.2.3", http.StatusOK},
+			} {
+				req, _ := http.NewRequest("GET", "http://test/api/h", nil)
+				req.Host = tc.host
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+
+				res, _, _, err := testcli.do(req)
+				if err != nil {
+					return err
+				}
+
+				if res.StatusCode != tc.expectedStatusCode {
+					return fmt.Errorf("%+v: expected status code %d but got %d", tc, tc.expectedStatusCode, res.StatusCode)
+				}
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test sticky sampling
+	if err := testcli.testRouteChaos("GET", "/api/i", NewSpec().
+		Error(http.StatusServiceUnavailable, "", 0.5).
+		StickySampling("header", "X-User-ID"),
+		func() error {
+			statuses := make(map[int]int)
+
+			for user := 0; user < 20; user++ {
+				var userStatus int
+
+				for i := 0; i < 5; i++ {
+					req, _ := http.NewRequest("GET", "http://test/api/i", nil)
+					req.Header.Set("X-User-ID", fmt.Sprintf("user-%d", user))
+
+					res, _, _, err := testcli.do(req)
+					if err != nil {
+						return err
+					}
+
+					if i > 0 && res.StatusCode != userStatus {
+						return fmt.Errorf("user-%d: inconsistent status codes %d and %d",
+							user, userStatus, res.StatusCode)
+					}
+					userStatus = res.StatusCode
+				}
+				statuses[userStatus]++
+			}
+
+			if statuses[http.StatusOK] == 0 || statuses[http.StatusServiceUnavailable] == 0 {
+				return fmt.Errorf("expected users both in and out of sampling, got %v", statuses)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test adding route chaos with invalid delay distribution spec
+	if err := testcli.testRouteChaos("POST", "/api/a", NewSpec().DelayUniform(100, 0, 1.0), nil); err == nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test chaos delay distribution injection
+	if err := testcli.testRouteChaos("GET", "/api/j", NewSpec().
+		DelayUniform(100, 200, 1.0),
+		func() error {
+			req, _ := http.NewRequest("GET", "http://test/api/j", nil)
+
+			res, _, latency, err := testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			header := strings.Fields(res.Header.Get("X-Chaos-Injected-Delay"))
+			if len(header) == 0 {
+				return fmt.Errorf("missing injected delay header")
+			}
+
+			delay, err := time.ParseDuration(header[0])
+			if err != nil {
+				return fmt.Errorf("invalid injected delay header: %s", err)
+			}
+
+			if delay < 100*time.Millisecond || delay > 200*time.Millisecond {
+				return fmt.Errorf("expected injected delay between 100ms and 200ms but got %s", delay)
+			}
+
+			if latency < float64(delay.Milliseconds()) {
+				return fmt.Errorf("expected minimum request delay %s but took %.2fms", delay, latency)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test chaos delay injection cancellation on client disconnection
+	if err := testcli.testRouteChaos("GET", "/api/k", NewSpec().
+		Delay(3000, 1.0),
+		func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			req, _ := http.NewRequestWithContext(ctx, "GET", "http://test/api/k", nil)
+			if _, _, _, err := testcli.do(req); err == nil {
+				return fmt.Errorf("expected request to time out")
+			}
+
+			for i := 0; i < 10; i++ {
+				res, err := testcli.chaos.http.Get("http://controller/?method=GET&path=/api/k")
+				if err != nil {
+					return fmt.Errorf("error sending HTTP request: %s\n", err)
+				}
+				body, _ := ioutil.ReadAll(res.Body)
+				res.Body.Close()
+
+				if strings.Contains(string(body), "Cancelled: 1 requests") {
+					return nil
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			return fmt.Errorf("expected cancelled request to be reported by controller")
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test chaos response phase delay injection
+	for _, phase := range []string{"after", "time_to_first_byte"} {
+		if err := testcli.testRouteChaos("GET", "/api/l", NewSpec().
+			Delay(500, 1.0).
+			DelayPhase(phase),
+			func() error {
+				var expectedMinDelay float64 = 500
+
+				req, _ := http.NewRequest("GET", "http://test/api/l", nil)
+
+				res, body, latency, err := testcli.do(req)
+				if err != nil {
+					return err
+				}
+
+				if latency <= expectedMinDelay {
+					return fmt.Errorf("%s: expected minimum request delay > %.2fms but took %.2fms",
+						phase, expectedMinDelay, latency)
+				}
+
+				if res.StatusCode != http.StatusOK || body != "ohai!" {
+					return fmt.Errorf("%s: unexpected response %d %q", phase, res.StatusCode, body)
+				}
+
+				if header := res.Header.Get("X-Chaos-Injected-Delay"); !strings.Contains(header, "phase: "+phase) {
+					return fmt.Errorf("%s: unexpected injected delay header %q", phase, header)
+				}
+
+				return nil
+			}); err != nil {
+			t.Errorf("route chaos test failed: %s", err)
+			t.FailNow()
+		}
+	}
+
+	// Test response bandwidth throttling
+	if err := testcli.testRouteChaos("GET", "/api/m", NewSpec().
+		Throttle(20, 1.0),
+		func() error {
+			var expectedMinDelay float64 = 250
+
+			req, _ := http.NewRequest("GET", "http://test/api/m", nil)
+
+			res, body, latency, err := testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			if latency <= expectedMinDelay {
+				return fmt.Errorf("expected minimum request delay > %.2fms but took %.2fms", expectedMinDelay, latency)
+			}
+
+			if res.StatusCode != http.StatusOK || body != "ohai!" {
+				return fmt.Errorf("unexpected response %d %q", res.StatusCode, body)
+			}
+
+			if header := res.Header.Get("X-Chaos-Injected-Throttle"); header == "" {
+				return fmt.Errorf("missing injected throttle header")
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test connection abort injection
+	for _, mode := range []string{"close", "reset", "partial"} {
+		if err := testcli.testRouteChaos("GET", "/api/n", NewSpec().
+			Abort(mode, 1.0),
+			func() error {
+				req, _ := http.NewRequest("GET", "http://test/api/n", nil)
+
+				res, _, _, err := testcli.do(req)
+				if mode == "reset" {
+					// UNIX socket connections cannot be reset.
+					if err != nil {
+						return fmt.Errorf("%s: expected fallback response but got error: %s", mode, err)
+					}
+
+					if header := res.Header.Get("X-Chaos-Injected-Abort"); res.StatusCode != http.StatusBadGateway ||
+						!strings.Contains(header, "fallback: connection reset not supported") {
+						return fmt.Errorf("%s: unexpected fallback response %d %q", mode, res.StatusCode, header)
+					}
+				} else if err == nil {
+					return fmt.Errorf("%s: expected aborted request to fail", mode)
+				}
+
+				// Test fallback when the connection cannot be hijacked
+				rec := httptest.NewRecorder()
+				chaos.Handler(router.ServeHTTP).ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusBadGateway {
+					return fmt.Errorf("%s: expected fallback status code %d but got %d",
+						mode, http.StatusBadGateway, rec.Code)
+				}
+
+				if header := rec.Header().Get("X-Chaos-Injected-Abort"); !strings.Contains(header, "fallback") {
+					return fmt.Errorf("%s: unexpected injected abort header %q", mode, header)
+				}
+
+				return nil
+			}); err != nil {
+			t.Errorf("route chaos test failed: %s", err)
+			t.FailNow()
+		}
+	}
+
+	// Test blackhole injection
+	if err := testcli.testRouteChaos("GET", "/api/o", NewSpec().
+		Blackhole(300, 1.0),
+		func() error {
+			var expectedMinDelay float64 = 300
+
+			req, _ := http.NewRequest("GET", "http://test/api/o", nil)
+
+			startTime := time.Now()
+			if _, _, _, err := testcli.do(req); err == nil {
+				return fmt.Errorf("expected blackholed request to fail")
+			}
+
+			if latency := time.Now().Sub(startTime).Seconds() * 1000; latency < expectedMinDelay {
+				return fmt.Errorf("expected minimum request delay > %.2fms but took %.2fms", expectedMinDelay, latency)
+			}
+
+			// Test client disconnection being reported by the controller
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			if _, _, _, err := testcli.do(req.WithContext(ctx)); err == nil {
+				return fmt.Errorf("expected blackholed request to time out")
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			res, err := testcli.chaos.http.Get("http://controller/?method=GET&path=/api/o")
+			if err != nil {
+				return fmt.Errorf("error sending HTTP request: %s\n", err)
+			}
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+
+			if !strings.Contains(string(body), "Blackhole released: 1 requests released by client disconnect") {
+				return fmt.Errorf("expected blackholed request to be reported as released by controller, got %q",
+					body)
+			}
+
+			// Test maximum number of concurrently blackholed requests
+			chaos.SetMaxBlackholed(0)
+			defer chaos.SetMaxBlackholed(DefaultMaxBlackholed)
+
+			res, _, _, err = testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			if res.StatusCode != http.StatusServiceUnavailable {
+				return fmt.Errorf("expected status code %d but got %d", http.StatusServiceUnavailable, res.StatusCode)
+			}
+
+			if header := res.Header.Get("X-Chaos-Injected-Blackhole"); !strings.Contains(header, "fallback") {
+				return fmt.Errorf("unexpected injected blackhole header %q", header)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test response body corruption injection
+	if err := testcli.testRouteChaos("GET", "/api/p", NewSpec().
+		Corruption("truncate", 3, 1.0),
+		func() error {
+			req, _ := http.NewRequest("GET", "http://test/api/p", nil)
+
+			res, body, _, err := testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			if body != "oha" {
+				return fmt.Errorf("expected truncated body %q but got %q", "oha", body)
+			}
+
+			if header := res.Header.Get("X-Chaos-Injected-Corruption"); header == "" {
+				return fmt.Errorf("missing injected corruption header")
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	if err := testcli.testRouteChaos("GET", "/api/p", NewSpec().
+		Corruption("content_length", 10, 1.0),
+		func() error {
+			req, _ := http.NewRequest("GET", "http://test/api/p", nil)
+
+			if _, _, _, err := testcli.do(req); err == nil {
+				return fmt.Errorf("expected reading response body with invalid content length to fail")
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test custom error response injection
+	if err := testcli.testRouteChaos("GET", "/api/q", NewSpec().
+		Error(http.StatusServiceUnavailable, "", 1.0).
+		ErrorHeader("Retry-After", "30").
+		ErrorBody("application/problem+json", `{"status":{{.StatusCode}},"instance":"{{.Method}} {{.Path}}",`+
+			`"request_id":"{{.RequestID}}"}`),
+		func() error {
+			var (
+				expectedStatusCode = http.StatusServiceUnavailable
+				expectedBody       = `{"status":503,"instance":"GET /api/q","request_id":"abc123"}`
+			)
+
+			req, _ := http.NewRequest("GET", "http://test/api/q", nil)
+			req.Header.Set("X-Request-ID", "abc123")
+
+			res, body, _, err := testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			if res.StatusCode != expectedStatusCode {
+				return fmt.Errorf("expected status code %d but got %d", expectedStatusCode, res.StatusCode)
+			}
+
+			if body != expectedBody {
+				return fmt.Errorf("expected body %q but got %q", expectedBody, body)
+			}
+
+			if contentType := res.Header.Get("Content-Type"); contentType != "application/problem+json" {
+				return fmt.Errorf("unexpected content type %q", contentType)
+			}
+
+			if retryAfter := res.Header.Get("Retry-After"); retryAfter != "30" {
+				return fmt.Errorf("unexpected Retry-After header %q", retryAfter)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test raw error body and content type injection
+	for _, tc := range []struct {
+		spec                *Spec
+		expectedBody        string
+		expectedContentType string
+	}{
+		{
+			spec: NewSpec().Error(http.StatusServiceUnavailable, "oops", 1.0).
+				ErrorContentType("text/x-oops"),
+			expectedBody:        "oops",
+			expectedContentType: "text/x-oops",
+		},
+		{
+			spec: NewSpec().Error(http.StatusServiceUnavailable, "", 1.0).
+				ErrorRawBody("application/json", `{"template":"{{.StatusCode}}"}`),
+			expectedBody:        `{"template":"{{.StatusCode}}"}`,
+			expectedContentType: "application/json",
+		},
+	} {
+		if err := testcli.testRouteChaos("GET", "/api/q", tc.spec, func() error {
+			req, _ := http.NewRequest("GET", "http://test/api/q", nil)
+
+			res, body, _, err := testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			if body != tc.expectedBody {
+				return fmt.Errorf("expected body %q but got %q", tc.expectedBody, body)
+			}
+
+			if contentType := res.Header.Get("Content-Type"); contentType != tc.expectedContentType {
+				return fmt.Errorf("unexpected content type %q", contentType)
+			}
+
+			return nil
+		}); err != nil {
+			t.Errorf("route chaos test failed: %s", err)
+			t.FailNow()
+		}
+	}
+
+	// Test weighted error outcomes injection
+	if err := testcli.testRouteChaos("GET", "/api/r", NewSpec().
+		WeightedError(1.0,
+			NewErrorOutcome(http.StatusInternalServerError, "", 1),
+			NewErrorOutcome(http.StatusServiceUnavailable, "", 1).Header("Retry-After", "30")),
+		func() error {
+			statusCodes := make(map[int]int)
+
+			for i := 0; i < 50; i++ {
+				req, _ := http.NewRequest("GET", "http://test/api/r", nil)
+
+				res, _, _, err := testcli.do(req)
+				if err != nil {
+					return err
+				}
+
+				if injected := res.Header.Get("X-Chaos-Injected-Error"); !strings.HasPrefix(injected,
+					fmt.Sprintf("%d ", res.StatusCode)) {
+					return fmt.Errorf("unexpected X-Chaos-Injected-Error header %q for status code %d",
+						injected, res.StatusCode)
+				}
+
+				switch res.StatusCode {
+				case http.StatusInternalServerError:
+				case http.StatusServiceUnavailable:
+					if retryAfter := res.Header.Get("Retry-After"); retryAfter != "30" {
+						return fmt.Errorf("unexpected Retry-After header %q", retryAfter)
+					}
+				default:
+					return fmt.Errorf("unexpected status code %d", res.StatusCode)
+				}
+				statusCodes[res.StatusCode]++
+			}
+
+			if len(statusCodes) != 2 {
+				return fmt.Errorf("expected both error outcomes to be injected but got %v", statusCodes)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test response mutation injection
+	if err := testcli.testRouteChaos("GET", "/api/s", NewSpec().
+		ResponseMutation(1.0).
+		MutateResponseSetHeader("ETag", `"chaos"`).
+		MutateResponseStatus(http.StatusInternalServerError),
+		func() error {
+			req, _ := http.NewRequest("GET", "http://test/api/s", nil)
+
+			res, body, _, err := testcli.do(req)
+			if err != nil {
+				return err
+			}
+
+			if res.StatusCode != http.StatusInternalServerError || body != "ohai!" {
+				return fmt.Errorf("unexpected response: %d %q", res.StatusCode, body)
+			}
+
+			if etag := res.Header.Get("ETag"); etag != `"chaos"` {
+				return fmt.Errorf("unexpected ETag header %q", etag)
+			}
+
+			if res.Header.Get("X-Chaos-Injected-Response-Mutation") == "" {
+				return fmt.Errorf("missing X-Chaos-Injected-Response-Mutation header")
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test rate limiting injection
+	if err := testcli.testRouteChaos("GET", "/api/t", NewSpec().
+		RateLimit(0.1, 2).
+		RateLimitKey("header", "X-User-ID"),
+		func() error {
+			for _, tc := range []struct {
+				user               string
+				expectedStatusCode int
+			}{
+				{"alice", http.StatusOK},
+				{"alice", http.StatusOK},
+				{"alice", http.StatusTooManyRequests},
+				{"bob", http.StatusOK},
+			} {
+				req, _ := http.NewRequest("GET", "http://test/api/t", nil)
+				req.Header.Set("X-User-ID", tc.user)
+
+				res, _, _, err := testcli.do(req)
+				if err != nil {
+					return err
+				}
+
+				if res.StatusCode != tc.expectedStatusCode {
+					return fmt.Errorf("%s: expected status code %d but got %d",
+						tc.user, tc.expectedStatusCode, res.StatusCode)
+				}
+
+				if res.Header.Get("X-RateLimit-Limit") != "2" {
+					return fmt.Errorf("unexpected X-RateLimit-Limit header %q", res.Header.Get("X-RateLimit-Limit"))
+				}
+
+				if res.StatusCode == http.StatusTooManyRequests && res.Header.Get("Retry-After") != "10" {
+					return fmt.Errorf("unexpected Retry-After header %q", res.Header.Get("Retry-After"))
+				}
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test concurrency overload injection
+	if err := testcli.testRouteChaos("GET", "/api/u", NewSpec().
+		Delay(500, 1.0).
+		Concurrency(1, "reject", 0),
+		func() error {
+			statusCodes := make(chan int, 2)
+
+			for i := 0; i < 2; i++ {
+				go func() {
+					res, _, _, err := testcli.sendRequest("GET", "/api/u")
+					if err != nil {
+						res = 0
+					}
+					statusCodes <- res
+				}()
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			rejected := <-statusCodes
+			if rejected != http.StatusServiceUnavailable {
+				return fmt.Errorf("expected status code %d but got %d", http.StatusServiceUnavailable, rejected)
+			}
+
+			if accepted := <-statusCodes; accepted != http.StatusOK {
+				return fmt.Errorf("expected status code %d but got %d", http.StatusOK, accepted)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test not yet started chaos spec
+	if err := testcli.testRouteChaos("GET", "/api/v", NewSpec().
+		Error(http.StatusInternalServerError, "", 1.0).
+		StartAt(time.Now().Add(time.Hour)),
+		func() error {
+			status, _, _, err := testcli.sendRequest("GET", "/api/v")
+			if err != nil {
+				return err
+			}
+
+			if status != http.StatusOK {
+				return fmt.Errorf("expected status code %d but got %d", http.StatusOK, status)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test adding route chaos ending in the past
+	for _, spec := range []*Spec{
+		NewSpec().Error(http.StatusInternalServerError, "", 1.0).
+			EndAt(time.Now().Add(-time.Minute)),
+		NewSpec().Error(http.StatusInternalServerError, "", 1.0).
+			StartAt(time.Now().Add(-time.Hour)).
+			EndAt(time.Now().Add(-time.Minute)),
+		NewSpec().Error(http.StatusInternalServerError, "", 1.0).
+			StartAt(time.Now().Add(-24 * time.Hour)).
+			During("1h"),
+		NewSpec().Error(http.StatusInternalServerError, "", 1.0).
+			During("-1m"),
+	} {
+		err := testcli.chaos.AddRouteChaos("GET", "/api/v", spec)
+		if err == nil || !strings.Contains(err.Error(), "400 Bad Request") {
+			t.Errorf("expected spec ending in the past to be rejected, got %v", err)
+		}
+	}
+
+	// Test maximum number of injections
+	if err := testcli.chaos.AddRouteChaos("GET", "/api/w", NewSpec().
+		Error(http.StatusServiceUnavailable, "", 1.0).
+		MaxInjections(3)); err != nil {
+		t.Fatalf("unable to add route chaos spec: %s", err)
+	}
+
+	for i, expectedStatusCode := range []int{
+		http.StatusServiceUnavailable,
+		http.StatusServiceUnavailable,
+		http.StatusServiceUnavailable,
+		http.StatusOK,
+	} {
+		status, _, _, err := testcli.sendRequest("GET", "/api/w")
+		if err != nil {
+			t.Fatalf("request #%d failed: %s", i+1, err)
+		}
+
+		if status != expectedStatusCode {
+			t.Fatalf("request #%d: expected status code %d but got %d", i+1, expectedStatusCode, status)
+		}
+	}
+
+	if err := testcli.chaos.DeleteRouteChaos("GET", "/api/w"); err == nil {
+		t.Errorf("expected chaos spec to be expired")
+	}
+
+	// Test maximum number of injections with concurrent requests
+	if err := testcli.chaos.AddRouteChaos("GET", "/api/w2", NewSpec().
+		Delay(50, 1.0).
+		Error(http.StatusServiceUnavailable, "", 1.0).
+		MaxInjections(3)); err != nil {
+		t.Fatalf("unable to add route chaos spec: %s", err)
+	}
+
+	var (
+		injected int64
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if status, _, _, err := testcli.sendRequest("GET", "/api/w2"); err == nil &&
+				status == http.StatusServiceUnavailable {
+				atomic.AddInt64(&injected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if injected != 3 {
+		t.Errorf("expected 3 injected errors but got %d", injected)
+	}
+
+	if err := testcli.chaos.DeleteRouteChaos("GET", "/api/w2"); err == nil {
+		t.Errorf("expected chaos spec to be expired")
+	}
+
+	// Test maximum number of injections per interval
+	if err := testcli.testRouteChaos("GET", "/api/x", NewSpec().
+		Error(http.StatusServiceUnavailable, "", 1.0).
+		MaxInjectionsPerInterval(2, "1h"),
+		func() error {
+			var injected int
+
+			for i := 0; i < 5; i++ {
+				status, _, _, err := testcli.sendRequest("GET", "/api/x")
+				if err != nil {
+					return err
+				}
+
+				if status == http.StatusServiceUnavailable {
+					injected++
+				}
+			}
+
+			if injected != 2 {
+				return fmt.Errorf("expected 2 injected errors but got %d", injected)
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test sequence injection
+	if err := testcli.testRouteChaos("GET", "/api/y", NewSpec().
+		Sequence(false, SequenceError(http.StatusServiceUnavailable, ""), SequenceDelay(100), SequencePass()).
+		SequenceKey("header", "X-Client-ID"),
+		func() error {
+			for _, tc := range []struct {
+				client             string
+				expectedStatusCode int
+				expectedDelay      bool
+			}{
+				{"alice", http.StatusServiceUnavailable, false},
+				{"alice", http.StatusOK, true},
+				{"bob", http.StatusServiceUnavailable, false},
+				{"alice", http.StatusOK, false},
+				{"alice", http.StatusOK, false},
+			} {
+				req, _ := http.NewRequest("GET", "http://test/api/y", nil)
+				req.Header.Set("X-Client-ID", tc.client)
+
+				res, _, latency, err := testcli.do(req)
+				if err != nil {
+					return err
+				}
+
+				if res.StatusCode != tc.expectedStatusCode {
+					return fmt.Errorf("%s: expected status code %d but got %d",
+						tc.client, tc.expectedStatusCode, res.StatusCode)
+				}
+
+				if delayed := latency >= 100; delayed != tc.expectedDelay {
+					return fmt.Errorf("%s: unexpected latency %.0fms", tc.client, latency)
+				}
+			}
+
+			return nil
+		}); err != nil {
+		t.Errorf("route chaos test failed: %s", err)
+		t.FailNow()
+	}
+
+	// Test seeded injection decisions reproducibility
+	var runs [2][]string
+	for i := range runs {
+		if err := testcli.testRouteChaos("GET", "/api/z", NewSpec().
+			Error(http.StatusServiceUnavailable, "", 0.5).
+			Seed(42),
+			func() error {
+				for n := 0; n < 20; n++ {
+					req, _ := http.NewRequest("GET", "http://test/api/z", nil)
+
+					res, _, _, err := testcli.do(req)
+					if err != nil {
+						return err
+					}
+
+					seed := res.Header.Get("X-Chaos-Injected-Seed")
+					if res.StatusCode == http.StatusServiceUnavailable &&
+						seed != fmt.Sprintf("42 (decision: %d)", n) {
+						return fmt.Errorf("request #%d: unexpected X-Chaos-Injected-Seed header %q", n+1, seed)
+					} else if res.StatusCode == http.StatusOK && seed != "" {
+						return fmt.Errorf("request #%d: unexpected X-Chaos-Injected-Seed header %q", n+1, seed)
+					}
+
+					runs[i] = append(runs[i], res.Status)
+				}
+
+				return nil
+			}); err != nil {
+			t.Errorf("route chaos test failed: %s", err)
+			t.FailNow()
+		}
+	}
+
+	if !reflect.DeepEqual(runs[0], runs[1]) {
+		t.Errorf("seeded runs differ: %v != %v", runs[0], runs[1])
+	}
+
+	t.Log("shutting down test server")
+
+	server.Shutdown(nil)
+}
+
+func Test_pathPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/api/a", "/api/a", true},
+		{"/api/a", "/api/b", false},
+		{"/api/users/*", "/api/users/42", true},
+		{"/api/users/*", "/api/users/42/posts", false},
+		{"/api/users/*.json", "/api/users/42.json", true},
+		{"/api/**", "/api", true},
+		{"/api/**", "/api/users/42/posts", true},
+		{"/api/**", "/apix", false},
+		{"/api/users/{id}", "/api/users/42", true},
+		{"/api/users/{id}", "/api/users/", false},
+		{"/api/users/{id:[0-9]+}", "/api/users/42", true},
+		{"/api/users/{id:[0-9]+}", "/api/users/bob", false},
+		{"/api/users/{id:[0-9]{2}}", "/api/users/42", true},
+	} {
+		p, err := parsePathPattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("unable to parse pattern %q: %s", tc.pattern, err)
+		}
+
+		if match := p.match(tc.path); match != tc.match {
+			t.Errorf("pattern %q: expected match(%q) = %t", tc.pattern, tc.path, tc.match)
+		}
+	}
+
+	for _, pattern := range []string{"api", "/api/**/a", "/api/{id", "/api/id}", "/api/{id:[}"} {
+		if _, err := parsePathPattern(pattern); err == nil {
+			t.Errorf("expected error parsing invalid pattern %q", pattern)
+		}
+	}
+}
+
+func Test_delaySpec(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+
+	for _, tc := range []struct {
+		spec string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{`{"duration":100,"p":1}`, 100 * time.Millisecond, 100 * time.Millisecond},
+		{`{"distribution":"uniform","min":100,"max":200,"p":1}`, 100 * time.Millisecond, 200 * time.Millisecond},
+		{`{"distribution":"normal","mean":100,"stddev":50,"max":150,"p":1}`, 0, 150 * time.Millisecond},
+		{`{"distribution":"exponential","mean":100,"min":10,"p":1}`, 10 * time.Millisecond, time.Hour},
+		{`{"distribution":"pareto","scale":50,"shape":1.5,"max":5000,"p":1}`, 50 * time.Millisecond, 5 * time.Second},
+		{`{"distribution":"percentiles","percentiles":{"p50":50,"p99":2000},"p":1}`, 0, 2 * time.Second},
+	} {
+		var s delaySpec
+
+		if err := json.Unmarshal([]byte(tc.spec), &s); err != nil {
+			t.Fatalf("unable to parse delay spec %s: %s", tc.spec, err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			if d := s.sample(rnd); d < tc.min || d > tc.max {
+				t.Fatalf("%s: sampled delay %s out of bounds [%s, %s]", tc.spec, d, tc.min, tc.max)
+			}
+		}
+	}
+
+	var s delaySpec
+	if err := json.Unmarshal([]byte(`{"distribution":"percentiles","percentiles":{"p50":50,"p99":2000},"p":1}`),
+		&s); err != nil {
+		t.Fatalf("unable to parse delay spec: %s", err)
+	}
+
+	for p, expected := range map[float64]float64{0: 0, 25: 25, 50: 50, 99: 2000, 100: 2000} {
+		if v := s.quantile(p); math.Abs(v-expected) > 0.001 {
+			t.Errorf("expected p%g delay %gms but got %gms", p, expected, v)
+		}
+	}
+
+	for _, spec := range []string{
+		`{"distribution":"normal","mean":0,"p":1}`,
+		`{"distribution":"pareto","scale":10,"p":1}`,
+		`{"distribution":"percentiles","percentiles":{"p50":100,"p99":10},"p":1}`,
+		`{"distribution":"percentiles","percentiles":{"x50":100},"p":1}`,
+		`{"distribution":"gamma","p":1}`,
+	} {
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("expected error parsing invalid delay spec %s", spec)
+		}
+	}
+}
+
+func Test_corruptionSpec(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	body := []byte(`{"id":42,"name":"ohai"}`)
+
+	for _, tc := range []struct {
+		spec           string
+		expectedLength int
+		check          func([]byte) bool
+	}{
+		{`{"mode":"truncate","percent":50,"p":1}`, len(body) / 2,
+			func(b []byte) bool { return bytes.Equal(b, body[:len(body)/2]) }},
+		{`{"mode":"flip","bytes":1,"p":1}`, len(body),
+			func(b []byte) bool { return len(b) == len(body) && !bytes.Equal(b, body) }},
+		{`{"mode":"garbage","bytes":8,"p":1}`, len(body) + 8,
+			func(b []byte) bool { return len(b) == len(body)+8 }},
+		{`{"mode":"content_length","bytes":-5,"p":1}`, len(body) - 5,
+			func(b []byte) bool { return bytes.Equal(b, body) }},
+	} {
+		var s corruptionSpec
+
+		if err := json.Unmarshal([]byte(tc.spec), &s); err != nil {
+			t.Fatalf("unable to parse corruption spec %s: %s", tc.spec, err)
+		}
+
+		corrupted, length := s.corrupt(append([]byte(nil), body...), rnd)
+		if length != tc.expectedLength {
+			t.Errorf("%s: expected advertised length %d but got %d", tc.spec, tc.expectedLength, length)
+		}
+
+		if !tc.check(corrupted) {
+			t.Errorf("%s: unexpected corrupted body %q", tc.spec, corrupted)
+		}
+	}
+
+	for _, spec := range []string{
+		`{"mode":"truncate","p":1}`,
+		`{"mode":"truncate","bytes":10,"percent":10,"p":1}`,
+		`{"mode":"flip","bytes":-1,"p":1}`,
+		`{"mode":"shuffle","p":1}`,
+	} {
+		var s corruptionSpec
+
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("expected error parsing invalid corruption spec %s", spec)
+		}
+	}
+}
+
+func Test_mutationSpec(t *testing.T) {
+	var s spec
+
+	if err := json.Unmarshal([]byte(`{
+		"request_mutation": {
+			"set_headers": {"Host": "legacy.example.net", "X-Tenant": "acme"},
+			"remove_headers": ["Authorization"],
+			"set_query": {"page": "2"},
+			"remove_query": ["debug"],
+			"body": "{}",
+			"p": 1
+		},
+		"response_mutation": {
+			"remove_headers": ["Cache-Control"],
+			"status_code": 503,
+			"p": 1
+		}
+	}`), &s); err != nil {
+		t.Fatalf("unable to parse spec: %s", err)
+	}
+
+	r := httptest.NewRequest("POST", "http://api.example.net/api/a?page=1&debug=true",
+		strings.NewReader(`{"id":42}`))
+	r.Header.Set("Authorization", "Bearer ohai")
+
+	mutated := s.requestMutation.mutate(r)
+
+	if mutated.Host != "legacy.example.net" {
+		t.Errorf("expected host %q but got %q", "legacy.example.net", mutated.Host)
+	}
+
+	if mutated.Header.Get("Authorization") != "" || mutated.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("unexpected mutated request headers %v", mutated.Header)
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		t.Errorf("original request headers must not be mutated")
+	}
+
+	if query := mutated.URL.RawQuery; query != "page=2" {
+		t.Errorf("expected query %q but got %q", "page=2", query)
+	}
+
+	if body, _ := ioutil.ReadAll(mutated.Body); string(body) != "{}" || mutated.ContentLength != 2 {
+		t.Errorf("unexpected mutated request body %q (length: %d)", body, mutated.ContentLength)
+	}
+
+	for _, tc := range []struct {
+		statusCode         int
+		expectedStatusCode int
+	}{
+		{http.StatusOK, http.StatusServiceUnavailable},
+		{http.StatusNotFound, http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		rw := newMutatedResponseWriter(rec, &s)
+
+		rw.Header().Set("Cache-Control", "max-age=3600")
+		rw.WriteHeader(tc.statusCode)
+		fmt.Fprint(rw, "ohai!")
+		finishResponse(rw)
+
+		if rec.Code != tc.expectedStatusCode {
+			t.Errorf("expected status code %d but got %d", tc.expectedStatusCode, rec.Code)
+		}
+
+		if rec.Header().Get("Cache-Control") != "" {
+			t.Errorf("unexpected Cache-Control header %q", rec.Header().Get("Cache-Control"))
+		}
+	}
+
+	for _, spec := range []string{
+		`{"request_mutation":{"p":1}}`,
+		`{"response_mutation":{"p":1}}`,
+		`{"response_mutation":{"status_code":42,"p":1}}`,
+	} {
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func Test_rateLimitSpec(t *testing.T) {
+	var s rateLimitSpec
+
+	if err := json.Unmarshal([]byte(`{"rate":2,"burst":3}`), &s); err != nil {
+		t.Fatalf("unable to parse rate limit spec: %s", err)
+	}
+
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := s.take("", now); !ok {
+			t.Fatalf("expected token #%d to be available", i+1)
+		}
+	}
+
+	ok, remaining, wait := s.take("", now)
+	if ok || remaining != 0 || wait != 500*time.Millisecond {
+		t.Errorf("expected exhausted bucket but got ok=%t remaining=%g wait=%s", ok, remaining, wait)
+	}
+
+	if ok, _, _ := s.take("", now.Add(500*time.Millisecond)); !ok {
+		t.Errorf("expected bucket to be refilled")
+	}
+
+	for _, spec := range []string{
+		`{"burst":1}`,
+		`{"rate":1,"burst":-1}`,
+		`{"rate":1,"key":"header"}`,
+	} {
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func Test_scheduleSpec(t *testing.T) {
+	for _, tc := range []struct {
+		spec     string
+		now      string
+		expected bool
+	}{
+		{`{"cron":"15 * * * *","duration":"5m"}`, "2026-10-14T10:15:00Z", true},
+		{`{"cron":"15 * * * *","duration":"5m"}`, "2026-10-14T10:19:59Z", true},
+		{`{"cron":"15 * * * *","duration":"5m"}`, "2026-10-14T10:20:00Z", false},
+		{`{"cron":"15 * * * *","duration":"5m"}`, "2026-10-14T10:14:59Z", false},
+		{`{"cron":"0 14 * * 1-5","duration":"30m"}`, "2026-10-14T14:10:00Z", true},
+		{`{"cron":"0 14 * * 1-5","duration":"30m"}`, "2026-10-17T14:10:00Z", false},
+		{`{"cron":"0 23 * * *","duration":"2h"}`, "2026-10-15T00:30:00Z", true},
+		{`{"cron":"*/20 9 * * *","duration":"1m","timezone":"Europe/Paris"}`, "2026-10-14T07:40:30Z", true},
+		{`{"cron":"*/20 9 * * *","duration":"1m","timezone":"Europe/Paris"}`, "2026-10-14T07:41:30Z", false},
+	} {
+		var s scheduleSpec
+
+		if err := json.Unmarshal([]byte(tc.spec), &s); err != nil {
+			t.Fatalf("unable to parse schedule spec %s: %s", tc.spec, err)
+		}
+
+		now, _ := time.Parse(time.RFC3339, tc.now)
+		if active := s.active(now); active != tc.expected {
+			t.Errorf("%s at %s: expected active=%t but got %t", tc.spec, tc.now, tc.expected, active)
+		}
+	}
+
+	for _, spec := range []string{
+		`{"cron":"15 * * *","duration":"5m"}`,
+		`{"cron":"60 * * * *","duration":"5m"}`,
+		`{"cron":"15 * * * *","duration":"0s"}`,
+		`{"cron":"15 * * * *","duration":"5m","timezone":"Mars/Olympus_Mons"}`,
+	} {
+		var s scheduleSpec
+
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func Test_rampSpec(t *testing.T) {
+	var s spec
+
+	if err := json.Unmarshal([]byte(`{
+		"start_at": "2026-10-14T10:00:00Z",
+		"delay": {"duration": 1000, "p": 0.5, "ramp": {"p_from": 0, "duration_from": 200, "over": "10m"}},
+		"error": {"status_code": 500, "p": 0.3, "ramp": {"p_from": 0, "over": "10m", "steps": 3}}
+	}`), &s); err != nil {
+		t.Fatalf("unable to parse spec: %s", err)
+	}
+
+	start, _ := time.Parse(time.RFC3339, "2026-10-14T10:00:00Z")
+
+	for _, tc := range []struct {
+		elapsed                  time.Duration
+		expectedDelayProbability float64
+		expectedDelayDuration    time.Duration
+		expectedErrorProbability float64
+	}{
+		{-time.Minute, 0, 200 * time.Millisecond, 0},
+		{0, 0, 200 * time.Millisecond, 0},
+		{5 * time.Minute, 0.25, 600 * time.Millisecond, 0.1},
+		{7 * time.Minute, 0.35, 760 * time.Millisecond, 0.2},
+		{time.Hour, 0.5, time.Second, 0.3},
+	} {
+		now := start.Add(tc.elapsed)
+
+		if p := s.delay.currentProbability(now); math.Abs(p-tc.expectedDelayProbability) > 1e-9 {
+			t.Errorf("%s: expected delay probability %g but got %g", tc.elapsed, tc.expectedDelayProbability, p)
+		}
+
+		if d := s.delay.currentDuration(now); d != tc.expectedDelayDuration {
+			t.Errorf("%s: expected delay duration %s but got %s", tc.elapsed, tc.expectedDelayDuration, d)
+		}
+
+		if p := s.err.currentProbability(now); math.Abs(p-tc.expectedErrorProbability) > 1e-9 {
+			t.Errorf("%s: expected error probability %g but got %g", tc.elapsed, tc.expectedErrorProbability, p)
+		}
+	}
+
+	for _, spec := range []string{
+		`{"delay":{"duration":100,"p":1,"ramp":{"over":"1m"}}}`,
+		`{"delay":{"duration":100,"p":1,"ramp":{"p_from":0,"over":"0s"}}}`,
+		`{"delay":{"distribution":"exponential","mean":100,"p":1,"ramp":{"duration_from":10,"over":"1m"}}}`,
+		`{"error":{"status_code":500,"p":1,"ramp":{"duration_from":10,"over":"1m"}}}`,
+	} {
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func Test_cycleSpec(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2026-10-14T10:00:00Z")
+
+	for _, tc := range []struct {
+		spec         string
+		elapsed      time.Duration
+		expectedOn   bool
+		expectedNext time.Duration
+	}{
+		{`{"on":"10s","off":"20s"}`, 0, true, 10 * time.Second},
+		{`{"on":"10s","off":"20s"}`, 9 * time.Second, true, time.Second},
+		{`{"on":"10s","off":"20s"}`, 10 * time.Second, false, 20 * time.Second},
+		{`{"on":"10s","off":"20s"}`, 65 * time.Second, true, 5 * time.Second},
+		{`{"on":"10s","off":"20s","offset":"25s"}`, 0, false, 5 * time.Second},
+	} {
+		var s cycleSpec
+
+		if err := json.Unmarshal([]byte(tc.spec), &s); err != nil {
+			t.Fatalf("unable to parse cycle spec %s: %s", tc.spec, err)
+		}
+		s.start = start
+
+		now := start.Add(tc.elapsed)
+		if on, next := s.phase(now); on != tc.expectedOn || next.Sub(now) != tc.expectedNext {
+			t.Errorf("%s after %s: expected on=%t next in %s but got on=%t next in %s",
+				tc.spec, tc.elapsed, tc.expectedOn, tc.expectedNext, on, next.Sub(now))
+		}
+	}
+
+	var s cycleSpec
+
+	if err := json.Unmarshal([]byte(`{"on":"10s","off":"20s","jitter":"5s"}`), &s); err != nil {
+		t.Fatalf("unable to parse cycle spec: %s", err)
+	}
+	s.start = start
+
+	for n := int64(0); n < 100; n++ {
+		if shift := s.shift(n); shift < -5*time.Second || shift > 5*time.Second || shift != s.shift(n) {
+			t.Fatalf("cycle %d: unexpected on period end shift %s", n, shift)
+		}
+
+		cycleStart := start.Add(time.Duration(n) * 30 * time.Second)
+		if on, _ := s.phase(cycleStart.Add(4 * time.Second)); !on {
+			t.Errorf("cycle %d: expected on phase", n)
+		}
+		if on, _ := s.phase(cycleStart.Add(16 * time.Second)); on {
+			t.Errorf("cycle %d: expected off phase", n)
+		}
+	}
+
+	// The jitter is reproducible with a given seed, whatever the cycle start time.
+	o := s
+	o.start = start.Add(time.Hour)
+	s.seed, o.seed = 42, 42
+
+	for n := int64(0); n < 10; n++ {
+		if s.shift(n) != o.shift(n) {
+			t.Errorf("cycle %d: expected identical on period end shifts with identical seeds", n)
+		}
+	}
+
+	for _, spec := range []string{
+		`{"on":"10s"}`,
+		`{"on":"0s","off":"10s"}`,
+		`{"on":"10s","off":"10s","jitter":"-1s"}`,
+	} {
+		if err := json.Unmarshal([]byte(spec), &s); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func Test_decisionSource(t *testing.T) {
+	values := func(seed int64, n uint64) []int64 {
+		rnd := rand.New(newDecisionSource(seed, n))
+
+		return []int64{rnd.Int63(), rnd.Int63(), rnd.Int63()}
+	}
+
+	if !reflect.DeepEqual(values(42, 3), values(42, 3)) {
+		t.Errorf("expected identical values for identical seed and decision")
+	}
+
+	if reflect.DeepEqual(values(42, 3), values(42, 4)) {
+		t.Errorf("expected different values for different decisions")
+	}
+
+	if reflect.DeepEqual(values(42, 3), values(43, 3)) {
+		t.Errorf("expected different values for different seeds")
+	}
+}
+
+func Test_derivedSeed(t *testing.T) {
+	c := Chaos{controller: newChaosController()}
+	c.SetSeed(42)
+
+	// outcomes returns the status codes of n requests sent to path after setting a 50% error chaos spec on it.
+	outcomes := func(path string, n int) ([]int, string) {
+		js, err := json.Marshal(NewSpec().Error(http.StatusServiceUnavailable, "", 0.5).s)
+		if err != nil {
+			t.Fatalf("unable to marshal spec to JSON: %s", err)
+		}
+
+		rec := httptest.NewRecorder()
+		c.controller.ServeHTTP(rec, httptest.NewRequest("PUT", controllerURL("GET", path, ""), bytes.NewReader(js)))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("unable to add route chaos spec: %s", rec.Body)
+		}
+
+		handler := c.Handler(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+
+		var (
+			codes = make([]int, n)
+			seed  string
+		)
+		for i := range codes {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			codes[i] = rec.Code
+			if s := rec.Header().Get("X-Chaos-Injected-Seed"); s != "" {
+				seed = strings.SplitN(s, " ", 2)[0]
+			}
+		}
+
+		return codes, seed
+	}
+
+	a, seedA := outcomes("/api/a", 200)
+	b, seedB := outcomes("/api/b", 200)
+
+	if reflect.DeepEqual(a, b) {
+		t.Errorf("expected specs seeded by the same controller seed to draw independent decisions")
+	}
+
+	if seedA == "42" || seedA == seedB {
+		t.Errorf("expected per-spec derived seeds but got %q and %q", seedA, seedB)
+	}
+
+	// The derived seed only depends on the controller seed and the spec route.
+	if replay, seed := outcomes("/api/a", 200); !reflect.DeepEqual(a, replay) || seed != seedA {
+		t.Errorf("expected replayed spec to draw identical decisions")
+	}
+}
+
+// benchmarkChaos benchmarks the processing of "GET /api/a" requests by a Chaos middleware featuring the chaos specs
+// indexed by target route path.
+func benchmarkChaos(b *testing.B, specs map[string]*Spec) {
+	c := Chaos{controller: newChaosController()}
+
+	for path, spec := range specs {
+		js, err := json.Marshal(spec.s)
+		if err != nil {
+			b.Fatalf("unable to marshal spec to JSON: %s", err)
+		}
+
+		rec := httptest.NewRecorder()
+		c.controller.ServeHTTP(rec, httptest.NewRequest("PUT", controllerURL("GET", path, ""), bytes.NewReader(js)))
+		if rec.Code != http.StatusNoContent {
+			b.Fatalf("unable to add route chaos spec: %s", rec.Body)
+		}
+	}
+
+	handler := c.Handler(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest("GET", "/api/a", nil)
+
+		for pb.Next() {
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+func Benchmark_Chaos_noSpec(b *testing.B) {
+	benchmarkChaos(b, nil)
+}
+
+func Benchmark_Chaos_nonMatching(b *testing.B) {
+	specs := make(map[string]*Spec)
+	for i := 0; i < 10; i++ {
+		specs[fmt.Sprintf("/api/b%d", i)] = NewSpec().Error(http.StatusServiceUnavailable, "", 1.0)
+	}
+	specs["/internal/**"] = NewSpec().Error(http.StatusServiceUnavailable, "", 1.0)
+
+	benchmarkChaos(b, specs)
+}
+
+func Benchmark_Chaos_matching(b *testing.B) {
+	benchmarkChaos(b, map[string]*Spec{
+		"/api/a": NewSpec().Error(http.StatusServiceUnavailable, "", 0.5),
+		"/api/*": NewSpec().Delay(100, 0),
+	})
+}
+
+func Test_injectionBudget(t *testing.T) {
+	var (
+		s        = spec{maxInjections: 3, intervalBudget: &intervalBudgetSpec{max: 2, interval: time.Hour}}
+		now      = time.Now()
+		acquired int64
+		wg       sync.WaitGroup
+	)
+
+	// Concurrent requests must not reserve more injections than the interval budget allows.
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, ok := s.acquireInjection(now); ok {
+				atomic.AddInt64(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 2 {
+		t.Errorf("expected 2 injections to be reserved but got %d", acquired)
+	}
+
+	// Injections reserved in the next window are bounded by the maximum number of injections.
+	acquired = 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, ok := s.acquireInjection(now.Add(time.Hour)); ok {
+				atomic.AddInt64(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 1 || !s.exhausted() {
+		t.Errorf("expected 1 injection to be reserved and the budget to be exhausted but got %d", acquired)
+	}
+
+	// Releasing a reserved injection makes it available again.
+	s = spec{maxInjections: 3}
+	budgets := make(chan *injectionBudget, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if b, ok := s.acquireInjection(now); ok {
+				budgets <- b
+			}
+		}()
+	}
+	wg.Wait()
+	close(budgets)
+
+	if len(budgets) != 3 {
+		t.Fatalf("expected 3 injections to be reserved but got %d", len(budgets))
+	}
+
+	(<-budgets).release()
+	if _, ok := s.acquireInjection(now); !ok {
+		t.Errorf("expected released injection to be available")
+	}
+	if _, ok := s.acquireInjection(now); ok {
+		t.Errorf("expected budget to be exhausted")
+	}
+}
+
+func Test_stickySampling(t *testing.T) {
+	path, _ := parsePathPattern("/api/a")
+	s := spec{path: path, sampling: &samplingSpec{key: "header", name: "X-User-ID"}, seed: 42}
+	o := spec{path: path, methods: []string{"GET"}, sampling: s.sampling, seed: 42}
+
+	var errors, delays, both, other int
+
+	for i := 0; i < 2000; i++ {
+		r := httptest.NewRequest("GET", "/api/a", nil)
+		r.Header.Set("X-User-ID", fmt.Sprintf("user-%d", i))
+
+		err, delay := s.sample(r, nil, "error", 0.1), s.sample(r, nil, "delay", 0.1)
+		if err {
+			errors++
+		}
+		if delay {
+			delays++
+		}
+		if err && delay {
+			both++
+		}
+		if err && s.sample(r, nil, "error", 0.1) != err {
+			t.Fatalf("user-%d: inconsistent sampling", i)
+		}
+		if err && o.sample(r, nil, "error", 0.1) {
+			other++
+		}
+	}
+
+	if errors < 100 || errors > 300 || delays < 100 || delays > 300 {
+		t.Errorf("expected about 200 sampled values per effect, got %d errors and %d delays", errors, delays)
+	}
+
+	// Independent effects and specs each select about 10% of the sampled values of the others.
+	if both > 60 || other > 60 {
+		t.Errorf("expected independent sampling, got %d values sampled by both effects and %d by both specs",
+			both, other)
+	}
+}
+
+func Test_delayedResponseWriter(t *testing.T) {
+	for _, phase := range []string{delayAfter, delayTimeToFirstByte} {
+		var (
+			s   = spec{delay: &delaySpec{phase: phase}}
+			rec = httptest.NewRecorder()
+			w   = newDelayedResponseWriter(rec, httptest.NewRequest("GET", "/api/a", nil), &s, 100*time.Millisecond)
+		)
+
+		// The delay must apply even if the downstream handler doesn't write anything.
+		start := time.Now()
+		w.finish()
+
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("%s: expected delay of at least 100ms but got %s", phase, elapsed)
+		}
+	}
 }
@@ -8,7 +8,9 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 // Client represents a chaos controller management client.
@@ -63,7 +65,121 @@ func (s *Spec) Delay(d int, p float64) *Spec {
 	return s
 }
 
-// Delay sets a chaos error injection with HTTP status code sc with an optional message msg at a p probability
+// DelayUniform sets a chaos delay injection uniformly distributed between min and max milliseconds at a p probability
+// (0 < p < 1) to chaos spec.
+func (s *Spec) DelayUniform(min, max int, p float64) *Spec {
+	s.s["delay"] = map[string]interface{}{
+		"distribution": "uniform",
+		"min":          min,
+		"max":          max,
+		"p":            p,
+	}
+
+	return s
+}
+
+// DelayNormal sets a chaos delay injection normally distributed with a mean of mean milliseconds and a standard
+// deviation of stddev milliseconds at a p probability (0 < p < 1) to chaos spec.
+func (s *Spec) DelayNormal(mean, stddev int, p float64) *Spec {
+	s.s["delay"] = map[string]interface{}{
+		"distribution": "normal",
+		"mean":         mean,
+		"stddev":       stddev,
+		"p":            p,
+	}
+
+	return s
+}
+
+// DelayExponential sets a chaos delay injection exponentially distributed with a mean of mean milliseconds at a p
+// probability (0 < p < 1) to chaos spec.
+func (s *Spec) DelayExponential(mean int, p float64) *Spec {
+	s.s["delay"] = map[string]interface{}{
+		"distribution": "exponential",
+		"mean":         mean,
+		"p":            p,
+	}
+
+	return s
+}
+
+// DelayPareto sets a long-tail chaos delay injection following a Pareto distribution of scale (i.e. minimum value)
+// scale milliseconds and shape shape at a p probability (0 < p < 1) to chaos spec.
+func (s *Spec) DelayPareto(scale int, shape float64, p float64) *Spec {
+	s.s["delay"] = map[string]interface{}{
+		"distribution": "pareto",
+		"scale":        scale,
+		"shape":        shape,
+		"p":            p,
+	}
+
+	return s
+}
+
+// DelayPercentiles sets a chaos delay injection distributed according to percentiles at a p probability (0 < p < 1)
+// to chaos spec. The percentiles map keys are expressed as "pN" with 0 <= N <= 100 (e.g. "p50", "p99.9") and
+// values in milliseconds.
+func (s *Spec) DelayPercentiles(percentiles map[string]int, p float64) *Spec {
+	s.s["delay"] = map[string]interface{}{
+		"distribution": "percentiles",
+		"percentiles":  percentiles,
+		"p":            p,
+	}
+
+	return s
+}
+
+// DelayBounds clamps the chaos delay injection set to chaos spec between min and max milliseconds (0 meaning no
+// upper bound). It must be called after one of the Delay* methods.
+func (s *Spec) DelayBounds(min, max int) *Spec {
+	if delay, ok := s.s["delay"].(map[string]interface{}); ok {
+		delay["min"] = min
+		delay["max"] = max
+	}
+
+	return s
+}
+
+// DelayPhase sets the phase of the chaos delay injection set to chaos spec: "before" (default) delays the request
+// before it is processed by the next handler, "after" holds the response produced by the next handler and
+// "time_to_first_byte" delays the first bytes of the response written by the next handler. It must be called after
+// one of the Delay* methods.
+func (s *Spec) DelayPhase(phase string) *Spec {
+	if delay, ok := s.s["delay"].(map[string]interface{}); ok {
+		delay["phase"] = phase
+	}
+
+	return s
+}
+
+// DelayRamp makes the probability of the chaos delay injection set to chaos spec ramp from pFrom to its configured
+// value over a duration over (value must be expressed using time.ParseDuration() format), linearly or in steps
+// steps if greater than 0. It must be called after one of the Delay* methods.
+func (s *Spec) DelayRamp(pFrom float64, over string, steps int) *Spec {
+	if delay, ok := s.s["delay"].(map[string]interface{}); ok {
+		delay["ramp"] = map[string]interface{}{
+			"p_from": pFrom,
+			"over":   over,
+			"steps":  steps,
+		}
+	}
+
+	return s
+}
+
+// DelayRampDuration makes the duration of the chaos fixed delay injection set to chaos spec ramp from durationFrom
+// milliseconds to its configured value. It must be called after the DelayRamp method.
+func (s *Spec) DelayRampDuration(durationFrom int) *Spec {
+	if delay, ok := s.s["delay"].(map[string]interface{}); ok {
+		if ramp, ok := delay["ramp"].(map[string]interface{}); ok {
+			ramp["duration_from"] = durationFrom
+		}
+	}
+
+	return s
+}
+
+// Error sets a chaos error injection with HTTP status code sc with an optional message msg at a p probability
 // (0 < p < 1) to chaos spec.
 func (s *Spec) Error(sc int, msg string, p float64) *Spec {
 	s.s["error"] = map[string]interface{}{
@@ -75,6 +191,375 @@ func (s *Spec) Error(sc int, msg string, p float64) *Spec {
 	return s
 }
 
+// ErrorOutcome represents one of the possible responses of a weighted chaos error injection.
+type ErrorOutcome map[string]interface{}
+
+// NewErrorOutcome returns an ErrorOutcome with HTTP status code sc and an optional message msg, chosen according to
+// its weight relative to the other outcomes of the chaos error injection.
+func NewErrorOutcome(sc int, msg string, weight float64) ErrorOutcome {
+	return ErrorOutcome{
+		"status_code": sc,
+		"message":     msg,
+		"weight":      weight,
+	}
+}
+
+// Header sets the header name to value in the error outcome response.
+func (o ErrorOutcome) Header(name, value string) ErrorOutcome {
+	headers, ok := o["headers"].(map[string]string)
+	if !ok {
+		headers = make(map[string]string)
+		o["headers"] = headers
+	}
+	headers[name] = value
+
+	return o
+}
+
+// WeightedError sets a chaos error injection at a p probability (0 < p < 1) to chaos spec, the response of each
+// injection being one of the outcomes randomly chosen according to their weights.
+func (s *Spec) WeightedError(p float64, outcomes ...ErrorOutcome) *Spec {
+	s.s["error"] = map[string]interface{}{
+		"outcomes": outcomes,
+		"p":        p,
+	}
+
+	return s
+}
+
+// Throttle sets a chaos bandwidth throttling of the response body to bps bytes per second at a p probability
+// (0 < p < 1) to chaos spec.
+func (s *Spec) Throttle(bps int, p float64) *Spec {
+	s.s["throttle"] = map[string]interface{}{
+		"bps": bps,
+		"p":   p,
+	}
+
+	return s
+}
+
+// ThrottleChunks sets the size in bytes of the chunks the response body is written in, and the delay in milliseconds
+// between chunks of the chaos bandwidth throttling set to chaos spec (bps being 0 if the throttling is only based on
+// the inter-chunk delay). It must be called after the Throttle method.
+func (s *Spec) ThrottleChunks(size, delay int) *Spec {
+	if throttle, ok := s.s["throttle"].(map[string]interface{}); ok {
+		throttle["chunk_size"] = size
+		throttle["chunk_delay"] = delay
+	}
+
+	return s
+}
+
+// Abort sets a chaos connection abort at a p probability (0 < p < 1) to chaos spec: mode "close" closes the client
+// connection without response, "reset" resets it and "partial" closes it after sending a part of the response.
+func (s *Spec) Abort(mode string, p float64) *Spec {
+	s.s["abort"] = map[string]interface{}{
+		"mode": mode,
+		"p":    p,
+	}
+
+	return s
+}
+
+// AbortPartialBytes sets the number of response body bytes sent before closing the client connection of the chaos
+// connection abort set to chaos spec in "partial" mode (default: half of the response body). It must be called after
+// the Abort method.
+func (s *Spec) AbortPartialBytes(n int) *Spec {
+	if abort, ok := s.s["abort"].(map[string]interface{}); ok {
+		abort["bytes"] = n
+	}
+
+	return s
+}
+
+// Blackhole sets a chaos blackhole at a p probability (0 < p < 1) to chaos spec: the request is held open without
+// ever being answered until the client disconnects or, if maxHold is greater than 0, for maxHold milliseconds after
+// which the client connection is closed.
+func (s *Spec) Blackhole(maxHold int, p float64) *Spec {
+	s.s["blackhole"] = map[string]interface{}{
+		"max_hold": maxHold,
+		"p":        p,
+	}
+
+	return s
+}
+
+// Corruption sets a chaos response body corruption at a p probability (0 < p < 1) to chaos spec. Depending on the
+// corruption mode, n is the number of bytes the body is truncated after ("truncate" mode), the number of random
+// bytes flipped ("flip" mode), the number of garbage bytes inserted ("garbage" mode) or the difference between the
+// advertised and the actual body length ("content_length" mode).
+func (s *Spec) Corruption(mode string, n int, p float64) *Spec {
+	s.s["corruption"] = map[string]interface{}{
+		"mode":  mode,
+		"bytes": n,
+		"p":     p,
+	}
+
+	return s
+}
+
+// CorruptionTruncatePercent sets a chaos response body truncation after percent % of the body at a p probability
+// (0 < p < 1) to chaos spec.
+func (s *Spec) CorruptionTruncatePercent(percent float64, p float64) *Spec {
+	s.s["corruption"] = map[string]interface{}{
+		"mode":    "truncate",
+		"percent": percent,
+		"p":       p,
+	}
+
+	return s
+}
+
+// ErrorRamp makes the probability of the chaos error injection set to chaos spec ramp from pFrom to its configured
+// value over a duration over (value must be expressed using time.ParseDuration() format), linearly or in steps
+// steps if greater than 0. It must be called after the Error or WeightedError methods.
+func (s *Spec) ErrorRamp(pFrom float64, over string, steps int) *Spec {
+	if e, ok := s.s["error"].(map[string]interface{}); ok {
+		e["ramp"] = map[string]interface{}{
+			"p_from": pFrom,
+			"over":   over,
+			"steps":  steps,
+		}
+	}
+
+	return s
+}
+
+// ErrorHeader adds a header name with value value to the chaos error injection response set to chaos spec. It must
+// be called after the Error method.
+func (s *Spec) ErrorHeader(name, value string) *Spec {
+	if e, ok := s.s["error"].(map[string]interface{}); ok {
+		headers, ok := e["headers"].(map[string]string)
+		if !ok {
+			headers = make(map[string]string)
+			e["headers"] = headers
+		}
+		headers[name] = value
+	}
+
+	return s
+}
+
+// ErrorBody sets the body of the chaos error injection response set to chaos spec, replacing the error message, with
+// content type contentType (default: "text/plain; charset=utf-8"). The body is a Go text/template template, where
+// the {{.StatusCode}}, {{.Method}}, {{.Path}}, {{.RequestID}} and {{.Captures}} fields refer to the request being
+// disrupted. It must be called after the Error method.
+func (s *Spec) ErrorBody(contentType, body string) *Spec {
+	if e, ok := s.s["error"].(map[string]interface{}); ok {
+		e["content_type"] = contentType
+		e["body"] = body
+	}
+
+	return s
+}
+
+// ErrorRawBody sets the body of the chaos error injection response set to chaos spec, replacing the error message,
+// with content type contentType (default: "text/plain; charset=utf-8"). Unlike with the ErrorBody method, the body is
+// returned as is. It must be called after the Error method.
+func (s *Spec) ErrorRawBody(contentType, body string) *Spec {
+	if e, ok := s.s["error"].(map[string]interface{}); ok {
+		e["content_type"] = contentType
+		e["raw_body"] = body
+	}
+
+	return s
+}
+
+// ErrorContentType sets the content type of the chaos error injection response set to chaos spec. It must be called
+// after the Error method.
+func (s *Spec) ErrorContentType(contentType string) *Spec {
+	if e, ok := s.s["error"].(map[string]interface{}); ok {
+		e["content_type"] = contentType
+	}
+
+	return s
+}
+
+// SequenceStep represents the outcome of a chaos sequence step.
+type SequenceStep map[string]interface{}
+
+// SequenceError returns a SequenceStep answering the request with HTTP status code sc and an optional message msg.
+func SequenceError(sc int, msg string) SequenceStep {
+	return SequenceStep{"type": "error", "status_code": sc, "message": msg}
+}
+
+// SequenceDelay returns a SequenceStep delaying the request by d milliseconds.
+func SequenceDelay(d int) SequenceStep {
+	return SequenceStep{"type": "delay", "duration": d}
+}
+
+// SequencePass returns a SequenceStep letting the request through.
+func SequencePass() SequenceStep {
+	return SequenceStep{"type": "pass"}
+}
+
+// SequenceAbort returns a SequenceStep aborting the client connection in mode mode ("close", "reset" or "partial").
+func SequenceAbort(mode string) SequenceStep {
+	return SequenceStep{"type": "abort", "mode": mode}
+}
+
+// Sequence sets a chaos sequence to chaos spec, each matching request consuming the next of the steps in order.
+// Once the sequence is over requests are let through, unless loop is true in which case the sequence restarts.
+func (s *Spec) Sequence(loop bool, steps ...SequenceStep) *Spec {
+	s.s["sequence"] = map[string]interface{}{
+		"steps": steps,
+		"loop":  loop,
+	}
+
+	return s
+}
+
+// SequenceKey makes the chaos sequence progress independently per request key value, the key being one of "header",
+// "cookie", "query" (name being the corresponding header, cookie or query parameter name) or "client_ip" (name being
+// ignored). It must be called after the Sequence method.
+func (s *Spec) SequenceKey(key, name string) *Spec {
+	if sequence, ok := s.s["sequence"].(map[string]interface{}); ok {
+		sequence["key"] = key
+		sequence["name"] = name
+	}
+
+	return s
+}
+
+// RateLimit sets a chaos rate limiting to chaos spec, answering requests with a "429 Too Many Requests" error once
+// the token bucket refilled at rate requests per second with a capacity of burst requests (default: the rate rounded
+// up) is exhausted.
+func (s *Spec) RateLimit(rate float64, burst int) *Spec {
+	s.s["rate_limit"] = map[string]interface{}{
+		"rate":  rate,
+		"burst": burst,
+	}
+
+	return s
+}
+
+// RateLimitKey makes the chaos rate limiting use a token bucket per request key value, the key being one of
+// "header", "cookie", "query" (name being the corresponding header, cookie or query parameter name) or "client_ip"
+// (name being ignored). It must be called after the RateLimit method.
+func (s *Spec) RateLimitKey(key, name string) *Spec {
+	if rateLimit, ok := s.s["rate_limit"].(map[string]interface{}); ok {
+		rateLimit["key"] = key
+		rateLimit["name"] = name
+	}
+
+	return s
+}
+
+// Concurrency sets a chaos overload emulation to chaos spec, triggered beyond limit requests concurrently in flight on
+// the route: in "delay" mode requests are delayed by delay milliseconds per request in flight beyond the limit, in
+// "reject" mode requests are answered with a "503 Service Unavailable" error.
+func (s *Spec) Concurrency(limit int, mode string, delay int) *Spec {
+	s.s["concurrency"] = map[string]interface{}{
+		"limit": limit,
+		"mode":  mode,
+		"delay": delay,
+	}
+
+	return s
+}
+
+// RequestMutation sets a chaos mutation of the request passed to the downstream handler at a p probability
+// (0 < p < 1) to chaos spec, the mutations being set using the MutateRequest* methods.
+func (s *Spec) RequestMutation(p float64) *Spec {
+	s.s["request_mutation"] = map[string]interface{}{"p": p}
+
+	return s
+}
+
+// MutateRequestAddHeader adds a value to the header name of the mutated request. It must be called after the
+// RequestMutation method.
+func (s *Spec) MutateRequestAddHeader(name, value string) *Spec {
+	return s.setMutation("request_mutation", "add_headers", name, value)
+}
+
+// MutateRequestSetHeader replaces the header name of the mutated request with value, setting the "Host" header
+// rewriting the request host. It must be called after the RequestMutation method.
+func (s *Spec) MutateRequestSetHeader(name, value string) *Spec {
+	return s.setMutation("request_mutation", "set_headers", name, value)
+}
+
+// MutateRequestRemoveHeaders removes the headers names from the mutated request. It must be called after the
+// RequestMutation method.
+func (s *Spec) MutateRequestRemoveHeaders(names ...string) *Spec {
+	if m, ok := s.s["request_mutation"].(map[string]interface{}); ok {
+		m["remove_headers"] = names
+	}
+
+	return s
+}
+
+// MutateRequestSetQuery replaces the URL query parameter name of the mutated request with value. It must be called
+// after the RequestMutation method.
+func (s *Spec) MutateRequestSetQuery(name, value string) *Spec {
+	return s.setMutation("request_mutation", "set_query", name, value)
+}
+
+// MutateRequestRemoveQuery removes the URL query parameters names from the mutated request. It must be called after
+// the RequestMutation method.
+func (s *Spec) MutateRequestRemoveQuery(names ...string) *Spec {
+	if m, ok := s.s["request_mutation"].(map[string]interface{}); ok {
+		m["remove_query"] = names
+	}
+
+	return s
+}
+
+// MutateRequestBody replaces the body of the mutated request. It must be called after the RequestMutation method.
+func (s *Spec) MutateRequestBody(body string) *Spec {
+	if m, ok := s.s["request_mutation"].(map[string]interface{}); ok {
+		m["body"] = body
+	}
+
+	return s
+}
+
+// ResponseMutation sets a chaos mutation of the response written by the downstream handler at a p probability
+// (0 < p < 1) to chaos spec, the mutations being set using the MutateResponse* methods.
+func (s *Spec) ResponseMutation(p float64) *Spec {
+	s.s["response_mutation"] = map[string]interface{}{"p": p}
+
+	return s
+}
+
+// MutateResponseSetHeader replaces the header name of the mutated response with value. It must be called after the
+// ResponseMutation method.
+func (s *Spec) MutateResponseSetHeader(name, value string) *Spec {
+	return s.setMutation("response_mutation", "set_headers", name, value)
+}
+
+// MutateResponseRemoveHeaders removes the headers names from the mutated response. It must be called after the
+// ResponseMutation method.
+func (s *Spec) MutateResponseRemoveHeaders(names ...string) *Spec {
+	if m, ok := s.s["response_mutation"].(map[string]interface{}); ok {
+		m["remove_headers"] = names
+	}
+
+	return s
+}
+
+// MutateResponseStatus replaces the status code of the mutated response with sc if it is successful (2xx). It must
+// be called after the ResponseMutation method.
+func (s *Spec) MutateResponseStatus(sc int) *Spec {
+	if m, ok := s.s["response_mutation"].(map[string]interface{}); ok {
+		m["status_code"] = sc
+	}
+
+	return s
+}
+
+func (s *Spec) setMutation(kind, field, name, value string) *Spec {
+	if m, ok := s.s[kind].(map[string]interface{}); ok {
+		values, ok := m[field].(map[string]string)
+		if !ok {
+			values = make(map[string]string)
+			m[field] = values
+		}
+		values[name] = value
+	}
+
+	return s
+}
+
 // During specifies that the route chaos spec effects must be enforced for a duration d
 // (value must be expressed using time.ParseDuration() format).
 func (s *Spec) During(d string) *Spec {
@@ -83,17 +568,198 @@ func (s *Spec) During(d string) *Spec {
 	return s
 }
 
-// AddRouteChaos adds chaos effects specified by spec to the route defined by method method (e.g. "POST")
-// and URL path path (e.g. "/api/foo"), and returns an error if it failed.
+// StartAt specifies that the route chaos spec effects must be enforced starting at time t. If set, the duration set
+// using the During method is relative to t.
+func (s *Spec) StartAt(t time.Time) *Spec {
+	s.s["start_at"] = t.Format(time.RFC3339)
+
+	return s
+}
+
+// EndAt specifies that the route chaos spec effects must be enforced until time t. It is mutually exclusive with the
+// During method.
+func (s *Spec) EndAt(t time.Time) *Spec {
+	s.s["end_at"] = t.Format(time.RFC3339)
+
+	return s
+}
+
+// Schedule specifies that the route chaos spec effects must only be enforced during recurring windows starting at
+// the times matching the cron expression cron (e.g. "15 * * * *" for every hour at :15, "0 14 * * 1-5" for weekdays
+// at 14:00) in the timezone tz (default: "UTC") and lasting for a duration d (value must be expressed using
+// time.ParseDuration() format).
+func (s *Spec) Schedule(cron, d, tz string) *Spec {
+	s.s["schedule"] = map[string]interface{}{
+		"cron":     cron,
+		"duration": d,
+		"timezone": tz,
+	}
+
+	return s
+}
+
+// Cycle makes the route chaos spec effects flap, alternating on periods of duration on during which they are enforced
+// and off periods of duration off (values must be expressed using time.ParseDuration() format).
+func (s *Spec) Cycle(on, off string) *Spec {
+	s.s["cycle"] = map[string]interface{}{
+		"on":  on,
+		"off": off,
+	}
+
+	return s
+}
+
+// CycleJitter randomly shifts the end of the on periods of the route chaos spec effects cycle by up to jitter, and
+// shifts the cycle start by offset (values must be expressed using time.ParseDuration() format, or be empty). It
+// must be called after the Cycle method.
+func (s *Spec) CycleJitter(jitter, offset string) *Spec {
+	if cycle, ok := s.s["cycle"].(map[string]interface{}); ok {
+		cycle["jitter"] = jitter
+		cycle["offset"] = offset
+	}
+
+	return s
+}
+
+// Seed sets the seed of the route chaos spec injection decision stream, making its random injection decisions
+// reproducible. Each decision is derived from the seed and the index of the decision reported in the
+// X-Chaos-Injected-Seed response header, so that a chaos run can be replayed exactly.
+func (s *Spec) Seed(seed int64) *Spec {
+	s.s["seed"] = seed
+
+	return s
+}
+
+// MaxInjections limits the number of requests the route chaos spec effects are injected in to n, the spec expiring
+// once the limit is reached.
+func (s *Spec) MaxInjections(n int) *Spec {
+	s.s["max_injections"] = n
+
+	return s
+}
+
+// MaxInjectionsPerInterval limits the number of requests the route chaos spec effects are injected in to n per
+// interval (value must be expressed using time.ParseDuration() format).
+func (s *Spec) MaxInjectionsPerInterval(n int, interval string) *Spec {
+	s.s["max_injections_per_interval"] = map[string]interface{}{
+		"max":      n,
+		"interval": interval,
+	}
+
+	return s
+}
+
+// PathRegex sets the regular expression re as the chaos spec route selector, matching the target route URL path
+// instead of the path pattern passed to AddRouteChaos (which must be empty).
+func (s *Spec) PathRegex(re string) *Spec {
+	s.s["path_regex"] = re
+
+	return s
+}
+
+// Matcher represents a chaos spec request value matching predicate.
+type Matcher map[string]interface{}
+
+// MatchExact returns a Matcher satisfied by request values equal to v.
+func MatchExact(v string) Matcher {
+	return Matcher{"exact": v}
+}
+
+// MatchPrefix returns a Matcher satisfied by request values starting with prefix.
+func MatchPrefix(prefix string) Matcher {
+	return Matcher{"prefix": prefix}
+}
+
+// MatchRegex returns a Matcher satisfied by request values matching the regular expression re.
+func MatchRegex(re string) Matcher {
+	return Matcher{"regex": re}
+}
+
+// MatchPresent returns a Matcher satisfied if the request value is present.
+func MatchPresent() Matcher {
+	return Matcher{"present": true}
+}
+
+// MatchAbsent returns a Matcher satisfied if the request value is absent.
+func MatchAbsent() Matcher {
+	return Matcher{"present": false}
+}
+
+// MatchHeader restricts the chaos spec effects to requests whose header name satisfies the matcher m.
+func (s *Spec) MatchHeader(name string, m Matcher) *Spec {
+	return s.addMatcher("headers", name, m)
+}
+
+// MatchQuery restricts the chaos spec effects to requests whose URL query parameter name satisfies the matcher m.
+func (s *Spec) MatchQuery(name string, m Matcher) *Spec {
+	return s.addMatcher("query", name, m)
+}
+
+// MatchCookie restricts the chaos spec effects to requests whose cookie name satisfies the matcher m.
+func (s *Spec) MatchCookie(name string, m Matcher) *Spec {
+	return s.addMatcher("cookies", name, m)
+}
+
+func (s *Spec) addMatcher(kind, name string, m Matcher) *Spec {
+	match, ok := s.s["match"].(map[string]interface{})
+	if !ok {
+		match = make(map[string]interface{})
+		s.s["match"] = match
+	}
+
+	predicate := map[string]interface{}{"name": name}
+	for k, v := range m {
+		predicate[k] = v
+	}
+
+	predicates, _ := match[kind].([]interface{})
+	match[kind] = append(predicates, predicate)
+
+	return s
+}
+
+// SourceCIDRs restricts the chaos spec effects to requests sent by clients whose IP address belongs to one of the
+// networks cidrs (CIDR notation, or single IP addresses). The client address is determined by trusting the depth
+// last entries of the X-Forwarded-For request header (0 meaning that the request remote address is used).
+func (s *Spec) SourceCIDRs(depth int, cidrs ...string) *Spec {
+	s.s["source_cidrs"] = cidrs
+	s.s["xff_depth"] = depth
+
+	return s
+}
+
+// Hosts restricts the chaos spec effects to requests sent to one of the virtual hosts hosts, either exact host
+// names or wildcard patterns matching any subdomain (e.g. "*.example.net").
+func (s *Spec) Hosts(hosts ...string) *Spec {
+	s.s["hosts"] = hosts
+
+	return s
+}
+
+// StickySampling makes the chaos spec effects probabilities apply to a hash of the request sampling key value instead
+// of each request, so that a given value (e.g. a user ID) is consistently in or out of the effects. The sampling key
+// key is one of "header", "cookie", "query" (name being the corresponding header, cookie or query parameter name)
+// or "client_ip" (name being ignored).
+func (s *Spec) StickySampling(key, name string) *Spec {
+	s.s["sampling"] = map[string]interface{}{
+		"key":  key,
+		"name": name,
+	}
+
+	return s
+}
+
+// AddRouteChaos adds chaos effects specified by spec to the route defined by method method (e.g. "POST", a
+// comma-separated list of methods such as "GET,POST" or "*" for any method)
+// and URL path pattern path (e.g. "/api/foo", "/api/users/{id}", "/api/**"), and returns an error if it failed.
+// The path pattern must be empty if the spec route selector is a regular expression set using Spec.PathRegex.
 func (c *Client) AddRouteChaos(method, path string, spec *Spec) error {
 	js, err := json.Marshal(spec.s)
 	if err != nil {
 		return fmt.Errorf("unable to marshal spec to JSON: %s", err)
 	}
 
-	req, err := http.NewRequest("PUT",
-		fmt.Sprintf("http://controller/?method=%s&path=%s", method, path),
-		bytes.NewBuffer(js))
+	req, err := http.NewRequest("PUT", controllerURL(method, path, ""), bytes.NewBuffer(js))
 	if err != nil {
 		return fmt.Errorf("error creating HTTP request: %s\n", err)
 	}
@@ -118,10 +784,20 @@ func (c *Client) AddRouteChaos(method, path string, spec *Spec) error {
 	return nil
 }
 
-// DeleteRouteChaos delete route chaos specification applied to the route defined by method method (e.g. "POST")
-// and URL path path (e.g. "/api/foo"), and returns an error if it failed.
+// DeleteRouteChaos delete route chaos specification applied to the route defined by method method (e.g. "POST",
+// "GET,POST" or "*") and URL path pattern path (e.g. "/api/foo"), and returns an error if it failed.
 func (c *Client) DeleteRouteChaos(method, path string) error {
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("http://controller/?method=%s&path=%s", method, path), nil)
+	return c.deleteRouteChaos(controllerURL(method, path, ""))
+}
+
+// DeleteRouteRegexChaos delete route chaos specification applied to the route defined by method method
+// (e.g. "POST") and URL path regular expression re, and returns an error if it failed.
+func (c *Client) DeleteRouteRegexChaos(method, re string) error {
+	return c.deleteRouteChaos(controllerURL(method, "", re))
+}
+
+func (c *Client) deleteRouteChaos(u string) error {
+	req, err := http.NewRequest("DELETE", u, nil)
 	if err != nil {
 		return fmt.Errorf("error creating HTTP request: %s\n", err)
 	}
@@ -143,3 +819,19 @@ func (c *Client) DeleteRouteChaos(method, path string) error {
 
 	return nil
 }
+
+// controllerURL returns the chaos controller URL addressing the route defined by method method and either URL path
+// pattern path or URL path regular expression pathRegex.
+func controllerURL(method, path, pathRegex string) string {
+	params := url.Values{"method": {method}}
+
+	if path != "" {
+		params.Set("path", path)
+	}
+
+	if pathRegex != "" {
+		params.Set("path_regex", pathRegex)
+	}
+
+	return "http://controller/?" + params.Encode()
+}
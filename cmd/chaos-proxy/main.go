@@ -16,6 +16,8 @@ var (
 	flagURL                string
 	flagBindAddr           string
 	flagControllerBindAddr string
+	flagMaxBlackholed      int
+	flagSeed               int64
 )
 
 func init() {
@@ -23,6 +25,9 @@ func init() {
 	flag.StringVar(&flagBindAddr, "bind-addr", defaultBindAddr, "network address:port to bind proxy to")
 	flag.StringVar(&flagControllerBindAddr, "controller-bind-addr", chaos.DefaultBindAddr,
 		"network endpoint to bind chaos controller to")
+	flag.IntVar(&flagMaxBlackholed, "max-blackholed", chaos.DefaultMaxBlackholed,
+		"maximum number of concurrently blackholed requests")
+	flag.Int64Var(&flagSeed, "seed", 0, "seed of the chaos injection decisions (random if not set)")
 	flag.Parse()
 }
 
@@ -36,6 +41,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to initialize chaos controller: %s", err)
 	}
+	chaos.SetMaxBlackholed(flagMaxBlackholed)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			chaos.SetSeed(flagSeed)
+		}
+	})
 
 	if err := http.ListenAndServe(flagBindAddr,
 		chaos.Handler(httputil.NewSingleHostReverseProxy(url).ServeHTTP)); err != nil {
@@ -3,6 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/falzm/chaos"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -11,21 +15,145 @@ import (
 var (
 	chaosAddr = kingpin.Flag("controller-addr", "Chaos controller address").Default(chaos.DefaultBindAddr).String()
 
-	addCmd                  = kingpin.Command("add", "Add route chaos")
-	addCmdFlagDuring        = addCmd.Flag("duration", "Chaos specification duration").String()
-	addCmdArgMethod         = addCmd.Arg("method", "HTTP route method").Required().String()
+	addCmd                = kingpin.Command("add", "Add route chaos")
+	addCmdFlagDuring      = addCmd.Flag("duration", "Chaos specification duration").String()
+	addCmdFlagStart       = addCmd.Flag("start", "Chaos specification start time (RFC 3339 format)").String()
+	addCmdFlagEnd         = addCmd.Flag("end", "Chaos specification end time (RFC 3339 format)").String()
+	addCmdFlagCycleOn     = addCmd.Flag("cycle-on", "Chaos specification flapping on period duration").String()
+	addCmdFlagCycleOff    = addCmd.Flag("cycle-off", "Chaos specification flapping off period duration").String()
+	addCmdFlagCycleJitter = addCmd.Flag("cycle-jitter",
+		"Chaos specification flapping on period end jitter").String()
+	addCmdFlagCycleOffset   = addCmd.Flag("cycle-offset", "Chaos specification flapping phase offset").String()
+	addCmdFlagMaxInjections = addCmd.Flag("max-injections",
+		"Chaos specification maximum number of injections before expiring").Int()
+	addCmdFlagMaxInjectionsPerInterval = addCmd.Flag("max-injections-per-interval",
+		"Chaos specification maximum number of injections per interval").Int()
+	addCmdFlagMaxInjectionsInterval = addCmd.Flag("max-injections-interval",
+		"Chaos specification maximum number of injections interval").Default("1m").String()
+	addCmdFlagSeed = addCmd.Flag("seed", "Chaos specification injection decisions seed").
+			Action(func(*kingpin.ParseContext) error { addCmdFlagSeedSet = true; return nil }).Int64()
+	addCmdFlagSeedSet  bool
+	addCmdFlagSchedule = addCmd.Flag("schedule",
+		"Chaos specification recurring windows start times (cron expression)").String()
+	addCmdFlagScheduleDuration = addCmd.Flag("schedule-duration",
+		"Chaos specification recurring windows duration").Default("1m").String()
+	addCmdFlagScheduleTimezone = addCmd.Flag("schedule-timezone",
+		"Chaos specification recurring windows timezone").Default("UTC").String()
+	addCmdArgMethod         = addCmd.Arg("method", "HTTP route method(s) (e.g. GET, GET,POST or '*')").Required().String()
 	addCmdArgPath           = addCmd.Arg("path", "HTTP route URL path").Required().String()
 	addCmdFlagDelayDuration = addCmd.Flag("delay-duration", "Delay injection duration (in milliseconds)").
 				Int()
 	addCmdFlagDelayProbability = addCmd.Flag("delay-probability", "Delay injection probability (0 < p < 1)").
 					Default("1.0").Float64()
+	addCmdFlagDelayPhase = addCmd.Flag("delay-phase",
+		"Delay injection phase (before, after or time_to_first_byte)").Default("before").String()
+	addCmdFlagDelayRampOver = addCmd.Flag("delay-ramp-over", "Delay injection ramp duration").String()
+	addCmdFlagDelayRampFrom = addCmd.Flag("delay-ramp-from", "Delay injection ramp start probability").
+				Float64()
+	addCmdFlagDelayRampDurationFrom = addCmd.Flag("delay-ramp-duration-from",
+		"Delay injection ramp start duration (in milliseconds)").Int()
+	addCmdFlagDelayRampSteps = addCmd.Flag("delay-ramp-steps",
+		"Delay injection ramp steps (default: linear ramp)").Int()
 	addCmdFlagErrorStatusCode  = addCmd.Flag("error-status-code", "Error injection status code").Int()
 	addCmdFlagErrorMessage     = addCmd.Flag("error-message", "Error injection message").String()
 	addCmdFlagErrorProbability = addCmd.Flag("error-probability", "Error injection probability (0 < p < 1)").
+					Action(func(*kingpin.ParseContext) error { addCmdFlagErrorProbabilitySet = true; return nil }).
 					Default("1.0").Float64()
+	addCmdFlagErrorProbabilitySet bool
+	addCmdFlagErrorRampOver       = addCmd.Flag("error-ramp-over", "Error injection ramp duration").String()
+	addCmdFlagErrorRampFrom       = addCmd.Flag("error-ramp-from", "Error injection ramp start probability").
+					Float64()
+	addCmdFlagErrorRampSteps = addCmd.Flag("error-ramp-steps",
+		"Error injection ramp steps (default: linear ramp)").Int()
+	addCmdFlagError = addCmd.Flag("error", "Weighted error injection outcome (STATUS:WEIGHT[:MESSAGE])").
+			Strings()
+	addCmdFlagErrorHeader      = addCmd.Flag("error-header", "Error injection response header (NAME: VALUE)").Strings()
+	addCmdFlagErrorContentType = addCmd.Flag("error-content-type", "Error injection response content type").String()
+	addCmdFlagErrorBody        = addCmd.Flag("error-body", "Error injection response body template").String()
+	addCmdFlagErrorRawBody     = addCmd.Flag("error-raw-body", "Error injection response raw body").String()
+
+	addCmdFlagThrottleBPS = addCmd.Flag("throttle-bps", "Response bandwidth throttling (in bytes per second)").
+				Int()
+	addCmdFlagThrottleChunkSize = addCmd.Flag("throttle-chunk-size", "Response throttling chunk size (in bytes)").
+					Int()
+	addCmdFlagThrottleChunkDelay = addCmd.Flag("throttle-chunk-delay",
+		"Response throttling delay between chunks (in milliseconds)").Int()
+	addCmdFlagThrottleProbability = addCmd.Flag("throttle-probability",
+		"Response throttling probability (0 < p < 1)").Default("1.0").Float64()
+
+	addCmdFlagAbortMode        = addCmd.Flag("abort", "Connection abort mode (close, reset or partial)").String()
+	addCmdFlagAbortBytes       = addCmd.Flag("abort-bytes", "Connection partial abort response bytes").Int()
+	addCmdFlagAbortProbability = addCmd.Flag("abort-probability", "Connection abort probability (0 < p < 1)").
+					Default("1.0").Float64()
+
+	addCmdFlagBlackhole        = addCmd.Flag("blackhole", "Hold requests without answering them").Bool()
+	addCmdFlagBlackholeMaxHold = addCmd.Flag("blackhole-max-hold",
+		"Blackhole maximum hold time (in milliseconds, default: until client disconnects)").Int()
+	addCmdFlagBlackholeProbability = addCmd.Flag("blackhole-probability", "Blackhole probability (0 < p < 1)").
+					Default("1.0").Float64()
+
+	addCmdFlagCorruptionMode = addCmd.Flag("corruption",
+		"Response body corruption mode (truncate, flip, garbage or content_length)").String()
+	addCmdFlagCorruptionBytes       = addCmd.Flag("corruption-bytes", "Response body corruption bytes").Int()
+	addCmdFlagCorruptionProbability = addCmd.Flag("corruption-probability",
+		"Response body corruption probability (0 < p < 1)").Default("1.0").Float64()
+
+	addCmdFlagSequence = addCmd.Flag("sequence",
+		"Sequence step (STATUS, error:STATUS[:MESSAGE], delay:MILLISECONDS, pass or abort[:MODE])").Strings()
+	addCmdFlagSequenceLoop = addCmd.Flag("sequence-loop", "Restart the sequence once over").Bool()
+	addCmdFlagSequenceKey  = addCmd.Flag("sequence-key",
+		"Sequence per-client key (header:NAME, cookie:NAME, query:NAME or client_ip)").String()
+
+	addCmdFlagRateLimit      = addCmd.Flag("rate-limit", "Rate limiting rate (in requests per second)").Float64()
+	addCmdFlagRateLimitBurst = addCmd.Flag("rate-limit-burst", "Rate limiting burst (default: the rate)").Int()
+	addCmdFlagRateLimitKey   = addCmd.Flag("rate-limit-key",
+		"Rate limiting per-client key (header:NAME, cookie:NAME, query:NAME or client_ip)").String()
+
+	addCmdFlagConcurrencyLimit = addCmd.Flag("concurrency-limit",
+		"Overload emulation concurrent requests limit").Int()
+	addCmdFlagConcurrencyMode = addCmd.Flag("concurrency-mode", "Overload emulation mode (delay or reject)").
+					Default("reject").String()
+	addCmdFlagConcurrencyDelay = addCmd.Flag("concurrency-delay",
+		"Overload emulation delay per request beyond the limit (in milliseconds)").Int()
+
+	addCmdFlagRequestAddHeader = addCmd.Flag("request-add-header", "Request mutation header to add (NAME: VALUE)").
+					Strings()
+	addCmdFlagRequestSetHeader = addCmd.Flag("request-set-header",
+		"Request mutation header to replace (NAME: VALUE)").Strings()
+	addCmdFlagRequestRemoveHeader = addCmd.Flag("request-remove-header", "Request mutation header to remove").
+					Strings()
+	addCmdFlagRequestSetQuery = addCmd.Flag("request-set-query",
+		"Request mutation query parameter to replace (NAME=VALUE)").Strings()
+	addCmdFlagRequestRemoveQuery = addCmd.Flag("request-remove-query", "Request mutation query parameter to remove").
+					Strings()
+	addCmdFlagRequestBody                = addCmd.Flag("request-body", "Request mutation replacement body").String()
+	addCmdFlagRequestMutationProbability = addCmd.Flag("request-mutation-probability",
+		"Request mutation probability (0 < p < 1)").Default("1.0").Float64()
+
+	addCmdFlagResponseSetHeader = addCmd.Flag("response-set-header",
+		"Response mutation header to replace (NAME: VALUE)").Strings()
+	addCmdFlagResponseRemoveHeader = addCmd.Flag("response-remove-header", "Response mutation header to remove").
+					Strings()
+	addCmdFlagResponseStatusCode = addCmd.Flag("response-status-code",
+		"Response mutation status code replacing successful responses status code").Int()
+	addCmdFlagResponseMutationProbability = addCmd.Flag("response-mutation-probability",
+		"Response mutation probability (0 < p < 1)").Default("1.0").Float64()
+
+	addCmdFlagMatchHeader = addCmd.Flag("match-header",
+		"Request header matcher (NAME=VALUE, NAME^=PREFIX, NAME~=REGEX, NAME or !NAME)").Strings()
+	addCmdFlagMatchQuery = addCmd.Flag("match-query",
+		"Request query parameter matcher (NAME=VALUE, NAME^=PREFIX, NAME~=REGEX, NAME or !NAME)").Strings()
+	addCmdFlagMatchCookie = addCmd.Flag("match-cookie",
+		"Request cookie matcher (NAME=VALUE, NAME^=PREFIX, NAME~=REGEX, NAME or !NAME)").Strings()
+	addCmdFlagSourceCIDR = addCmd.Flag("source-cidr", "Client source network (CIDR notation or IP address)").
+				Strings()
+	addCmdFlagXFFDepth = addCmd.Flag("xff-depth", "Trusted X-Forwarded-For request header depth").Int()
+	addCmdFlagHost     = addCmd.Flag("host", "Request virtual host (e.g. api.example.net or *.example.net)").Strings()
+	addCmdFlagSampling = addCmd.Flag("sampling",
+		"Sticky sampling key (header:NAME, cookie:NAME, query:NAME or client_ip)").String()
 
 	delCmd          = kingpin.Command("delete", "Delete route chaos").Alias("del")
-	delCmdArgMethod = delCmd.Arg("method", "HTTP route method").Required().String()
+	delCmdArgMethod = delCmd.Arg("method", "HTTP route method(s) (e.g. GET, GET,POST or '*')").Required().String()
 	delCmdArgPath   = delCmd.Arg("path", "HTTP route URL path").Required().String()
 )
 
@@ -37,17 +165,202 @@ func main() {
 		spec := chaos.NewSpec()
 
 		if *addCmdFlagDelayDuration > 0 {
-			spec.Delay(*addCmdFlagDelayDuration, *addCmdFlagDelayProbability)
+			spec.Delay(*addCmdFlagDelayDuration, *addCmdFlagDelayProbability).DelayPhase(*addCmdFlagDelayPhase)
+
+			if *addCmdFlagDelayRampOver != "" {
+				spec.DelayRamp(*addCmdFlagDelayRampFrom, *addCmdFlagDelayRampOver, *addCmdFlagDelayRampSteps)
+
+				if *addCmdFlagDelayRampDurationFrom > 0 {
+					spec.DelayRampDuration(*addCmdFlagDelayRampDurationFrom)
+				}
+			}
 		}
 
-		if *addCmdFlagErrorStatusCode > 0 {
+		if len(*addCmdFlagError) > 0 {
+			if *addCmdFlagErrorStatusCode > 0 || *addCmdFlagErrorMessage != "" || addCmdFlagErrorProbabilitySet {
+				kingpin.Fatalf("--error flag is mutually exclusive with --error-status-code, --error-message and " +
+					"--error-probability flags")
+			}
+
+			p, outcomes := parseErrorOutcomes(*addCmdFlagError)
+			spec.WeightedError(p, outcomes...)
+		} else if *addCmdFlagErrorStatusCode > 0 {
 			spec.Error(*addCmdFlagErrorStatusCode, *addCmdFlagErrorMessage, *addCmdFlagErrorProbability)
 		}
 
+		if len(*addCmdFlagError) > 0 || *addCmdFlagErrorStatusCode > 0 {
+			if *addCmdFlagErrorRampOver != "" {
+				spec.ErrorRamp(*addCmdFlagErrorRampFrom, *addCmdFlagErrorRampOver, *addCmdFlagErrorRampSteps)
+			}
+
+			for _, h := range *addCmdFlagErrorHeader {
+				spec.ErrorHeader(parseHeader(h))
+			}
+
+			switch {
+			case *addCmdFlagErrorBody != "" && *addCmdFlagErrorRawBody != "":
+				kingpin.Fatalf("--error-body and --error-raw-body flags are mutually exclusive")
+
+			case *addCmdFlagErrorBody != "":
+				spec.ErrorBody(*addCmdFlagErrorContentType, *addCmdFlagErrorBody)
+
+			case *addCmdFlagErrorRawBody != "":
+				spec.ErrorRawBody(*addCmdFlagErrorContentType, *addCmdFlagErrorRawBody)
+
+			case *addCmdFlagErrorContentType != "":
+				spec.ErrorContentType(*addCmdFlagErrorContentType)
+			}
+		}
+
+		if *addCmdFlagThrottleBPS > 0 || *addCmdFlagThrottleChunkDelay > 0 {
+			spec.Throttle(*addCmdFlagThrottleBPS, *addCmdFlagThrottleProbability).
+				ThrottleChunks(*addCmdFlagThrottleChunkSize, *addCmdFlagThrottleChunkDelay)
+		}
+
+		if *addCmdFlagAbortMode != "" {
+			spec.Abort(*addCmdFlagAbortMode, *addCmdFlagAbortProbability).AbortPartialBytes(*addCmdFlagAbortBytes)
+		}
+
+		if *addCmdFlagBlackhole {
+			spec.Blackhole(*addCmdFlagBlackholeMaxHold, *addCmdFlagBlackholeProbability)
+		}
+
+		if *addCmdFlagCorruptionMode != "" {
+			spec.Corruption(*addCmdFlagCorruptionMode, *addCmdFlagCorruptionBytes, *addCmdFlagCorruptionProbability)
+		}
+
+		if len(*addCmdFlagSequence) > 0 {
+			steps := make([]chaos.SequenceStep, len(*addCmdFlagSequence))
+			for i, step := range *addCmdFlagSequence {
+				steps[i] = parseSequenceStep(step)
+			}
+			spec.Sequence(*addCmdFlagSequenceLoop, steps...)
+
+			if *addCmdFlagSequenceKey != "" {
+				spec.SequenceKey(parseKey(*addCmdFlagSequenceKey))
+			}
+		}
+
+		if *addCmdFlagRateLimit > 0 {
+			spec.RateLimit(*addCmdFlagRateLimit, *addCmdFlagRateLimitBurst)
+
+			if *addCmdFlagRateLimitKey != "" {
+				spec.RateLimitKey(parseKey(*addCmdFlagRateLimitKey))
+			}
+		}
+
+		if *addCmdFlagConcurrencyLimit > 0 {
+			spec.Concurrency(*addCmdFlagConcurrencyLimit, *addCmdFlagConcurrencyMode, *addCmdFlagConcurrencyDelay)
+		}
+
+		if len(*addCmdFlagRequestAddHeader) > 0 || len(*addCmdFlagRequestSetHeader) > 0 ||
+			len(*addCmdFlagRequestRemoveHeader) > 0 || len(*addCmdFlagRequestSetQuery) > 0 ||
+			len(*addCmdFlagRequestRemoveQuery) > 0 || *addCmdFlagRequestBody != "" {
+			spec.RequestMutation(*addCmdFlagRequestMutationProbability)
+
+			for _, h := range *addCmdFlagRequestAddHeader {
+				spec.MutateRequestAddHeader(parseHeader(h))
+			}
+
+			for _, h := range *addCmdFlagRequestSetHeader {
+				spec.MutateRequestSetHeader(parseHeader(h))
+			}
+
+			if len(*addCmdFlagRequestRemoveHeader) > 0 {
+				spec.MutateRequestRemoveHeaders(*addCmdFlagRequestRemoveHeader...)
+			}
+
+			for _, q := range *addCmdFlagRequestSetQuery {
+				param := strings.SplitN(q, "=", 2)
+				if len(param) != 2 {
+					log.Fatalf("invalid query parameter %q: expected NAME=VALUE", q)
+				}
+				spec.MutateRequestSetQuery(param[0], param[1])
+			}
+
+			if len(*addCmdFlagRequestRemoveQuery) > 0 {
+				spec.MutateRequestRemoveQuery(*addCmdFlagRequestRemoveQuery...)
+			}
+
+			if *addCmdFlagRequestBody != "" {
+				spec.MutateRequestBody(*addCmdFlagRequestBody)
+			}
+		}
+
+		if len(*addCmdFlagResponseSetHeader) > 0 || len(*addCmdFlagResponseRemoveHeader) > 0 ||
+			*addCmdFlagResponseStatusCode > 0 {
+			spec.ResponseMutation(*addCmdFlagResponseMutationProbability)
+
+			for _, h := range *addCmdFlagResponseSetHeader {
+				spec.MutateResponseSetHeader(parseHeader(h))
+			}
+
+			if len(*addCmdFlagResponseRemoveHeader) > 0 {
+				spec.MutateResponseRemoveHeaders(*addCmdFlagResponseRemoveHeader...)
+			}
+
+			if *addCmdFlagResponseStatusCode > 0 {
+				spec.MutateResponseStatus(*addCmdFlagResponseStatusCode)
+			}
+		}
+
+		for _, m := range *addCmdFlagMatchHeader {
+			spec.MatchHeader(parseMatcher(m))
+		}
+
+		for _, m := range *addCmdFlagMatchQuery {
+			spec.MatchQuery(parseMatcher(m))
+		}
+
+		for _, m := range *addCmdFlagMatchCookie {
+			spec.MatchCookie(parseMatcher(m))
+		}
+
+		if len(*addCmdFlagSourceCIDR) > 0 {
+			spec.SourceCIDRs(*addCmdFlagXFFDepth, *addCmdFlagSourceCIDR...)
+		}
+
+		if len(*addCmdFlagHost) > 0 {
+			spec.Hosts(*addCmdFlagHost...)
+		}
+
+		if *addCmdFlagSampling != "" {
+			spec.StickySampling(parseKey(*addCmdFlagSampling))
+		}
+
 		if *addCmdFlagDuring != "" {
 			spec.During(*addCmdFlagDuring)
 		}
 
+		if *addCmdFlagStart != "" {
+			spec.StartAt(parseTime(*addCmdFlagStart))
+		}
+
+		if *addCmdFlagEnd != "" {
+			spec.EndAt(parseTime(*addCmdFlagEnd))
+		}
+
+		if *addCmdFlagCycleOn != "" || *addCmdFlagCycleOff != "" {
+			spec.Cycle(*addCmdFlagCycleOn, *addCmdFlagCycleOff).
+				CycleJitter(*addCmdFlagCycleJitter, *addCmdFlagCycleOffset)
+		}
+
+		if *addCmdFlagMaxInjections > 0 {
+			spec.MaxInjections(*addCmdFlagMaxInjections)
+		}
+
+		if *addCmdFlagMaxInjectionsPerInterval > 0 {
+			spec.MaxInjectionsPerInterval(*addCmdFlagMaxInjectionsPerInterval, *addCmdFlagMaxInjectionsInterval)
+		}
+
+		if addCmdFlagSeedSet {
+			spec.Seed(*addCmdFlagSeed)
+		}
+
+		if *addCmdFlagSchedule != "" {
+			spec.Schedule(*addCmdFlagSchedule, *addCmdFlagScheduleDuration, *addCmdFlagScheduleTimezone)
+		}
+
 		if err := chaos.NewClient(*chaosAddr).AddRouteChaos(*addCmdArgMethod, *addCmdArgPath, spec); err != nil {
 			log.Fatalf("%s", err)
 		}
@@ -60,3 +373,146 @@ func main() {
 
 	fmt.Println("OK")
 }
+
+// parseErrorOutcomes parses error outcomes expressed as STATUS:WEIGHT[:MESSAGE], the weight being the probability
+// of the outcome: it returns the overall error injection probability and the outcomes.
+func parseErrorOutcomes(specs []string) (float64, []chaos.ErrorOutcome) {
+	var (
+		outcomes = make([]chaos.ErrorOutcome, len(specs))
+		p        float64
+	)
+
+	for i, s := range specs {
+		parts := strings.SplitN(s, ":", 3)
+		if len(parts) < 2 {
+			log.Fatalf("invalid error outcome %q: expected STATUS:WEIGHT[:MESSAGE]", s)
+		}
+
+		sc, err := strconv.Atoi(parts[0])
+		if err != nil {
+			log.Fatalf("invalid error outcome %q: invalid status code: %s", s, err)
+		}
+
+		weight, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			log.Fatalf("invalid error outcome %q: invalid weight: %s", s, err)
+		}
+
+		var msg string
+		if len(parts) == 3 {
+			msg = parts[2]
+		}
+
+		outcomes[i] = chaos.NewErrorOutcome(sc, msg, weight)
+		p += weight
+	}
+
+	return math.Min(p, 1), outcomes
+}
+
+// parseSequenceStep parses a sequence step expressed as STATUS, error:STATUS[:MESSAGE], delay:MILLISECONDS, pass or
+// abort[:MODE].
+func parseSequenceStep(s string) chaos.SequenceStep {
+	step := strings.SplitN(s, ":", 3)
+
+	if sc, err := strconv.Atoi(step[0]); err == nil {
+		return chaos.SequenceError(sc, "")
+	}
+
+	switch {
+	case step[0] == "error" && len(step) > 1:
+		sc, err := strconv.Atoi(step[1])
+		if err != nil {
+			log.Fatalf("invalid sequence step %q: invalid status code: %s", s, err)
+		}
+
+		var msg string
+		if len(step) == 3 {
+			msg = step[2]
+		}
+
+		return chaos.SequenceError(sc, msg)
+
+	case step[0] == "delay" && len(step) == 2:
+		d, err := strconv.Atoi(step[1])
+		if err != nil {
+			log.Fatalf("invalid sequence step %q: invalid duration: %s", s, err)
+		}
+
+		return chaos.SequenceDelay(d)
+
+	case step[0] == "pass" && len(step) == 1:
+		return chaos.SequencePass()
+
+	case step[0] == "abort" && len(step) <= 2:
+		var mode string
+		if len(step) == 2 {
+			mode = step[1]
+		}
+
+		return chaos.SequenceAbort(mode)
+	}
+
+	log.Fatalf("invalid sequence step %q: expected STATUS, error:STATUS[:MESSAGE], delay:MILLISECONDS, pass or "+
+		"abort[:MODE]", s)
+
+	return nil
+}
+
+// parseTime parses a time expressed in RFC 3339 format.
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		log.Fatalf("invalid time %q: %s", s, err)
+	}
+
+	return t
+}
+
+// parseKey parses a request key expressed as KEY:NAME or KEY.
+func parseKey(s string) (string, string) {
+	key := strings.SplitN(s, ":", 2)
+	if len(key) == 1 {
+		return key[0], ""
+	}
+
+	return key[0], key[1]
+}
+
+// parseHeader parses a HTTP header expressed as NAME: VALUE.
+func parseHeader(s string) (string, string) {
+	header := strings.SplitN(s, ":", 2)
+	if len(header) != 2 {
+		log.Fatalf("invalid header %q: expected NAME: VALUE", s)
+	}
+
+	return strings.TrimSpace(header[0]), strings.TrimSpace(header[1])
+}
+
+// parseMatcher parses a request value matcher expressed as NAME=VALUE (exact value), NAME^=PREFIX (value prefix),
+// NAME~=REGEX (value regular expression), NAME (presence) or !NAME (absence).
+func parseMatcher(s string) (string, chaos.Matcher) {
+	// The operator is the first one occurring in the expression, all operators ending with "=".
+	if i := strings.Index(s, "="); i > 0 {
+		switch s[i-1] {
+		case '^':
+			if i > 1 {
+				return s[:i-1], chaos.MatchPrefix(s[i+1:])
+			}
+
+		case '~':
+			if i > 1 {
+				return s[:i-1], chaos.MatchRegex(s[i+1:])
+			}
+
+		default:
+			return s[:i], chaos.MatchExact(s[i+1:])
+		}
+	}
+
+	if strings.HasPrefix(s, "!") {
+		return strings.TrimPrefix(s, "!"), chaos.MatchAbsent()
+	}
+
+	return s, chaos.MatchPresent()
+}
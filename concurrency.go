@@ -0,0 +1,98 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Supported concurrency overload modes.
+const (
+	overloadDelay  = "delay"
+	overloadReject = "reject"
+)
+
+type concurrencySpec struct {
+	limit int64
+	mode  string
+	delay time.Duration
+}
+
+func (s *concurrencySpec) UnmarshalJSON(data []byte) error {
+	concurrencySpec := struct {
+		Limit int64  `json:"limit"`
+		Mode  string `json:"mode"`
+		Delay int    `json:"delay"`
+	}{}
+
+	if err := json.Unmarshal(data, &concurrencySpec); err != nil {
+		return err
+	}
+
+	s.limit = concurrencySpec.Limit
+	s.mode = concurrencySpec.Mode
+	s.delay = time.Duration(concurrencySpec.Delay) * time.Millisecond
+
+	if s.limit <= 0 {
+		return fmt.Errorf("concurrency limit parameter value must be greater than 0 ")
+	}
+
+	switch s.mode {
+	case overloadDelay:
+		if s.delay <= 0 {
+			return fmt.Errorf("concurrency delay parameter value must be greater than 0 in delay mode")
+		}
+
+	case overloadReject:
+
+	default:
+		return fmt.Errorf("concurrency mode parameter value must be one of delay or reject")
+	}
+
+	return nil
+}
+
+func (s *concurrencySpec) String() string {
+	if s.mode == overloadDelay {
+		return fmt.Sprintf("limit %d, %s per queued request", s.limit, s.delay)
+	}
+
+	return fmt.Sprintf("limit %d, reject", s.limit)
+}
+
+// injectConcurrency emulates the overload of the server if the number of requests in flight on the spec route
+// exceeds the spec concurrency limit: in "delay" mode the HTTP request r is delayed proportionally to the number of
+// requests beyond the limit, in "reject" mode a "503 Service Unavailable" error is written to rw. It returns false
+// if the request processing must be interrupted.
+func (s *spec) injectConcurrency(rw http.ResponseWriter, r *http.Request) bool {
+	if s.concurrency == nil {
+		return true
+	}
+
+	inFlight := atomic.LoadInt64(&s.inFlight)
+	if inFlight <= s.concurrency.limit {
+		return true
+	}
+	atomic.AddUint64(&s.overloaded, 1)
+
+	rw.Header().Set("X-Chaos-Injected-Selector", s.target())
+
+	if s.concurrency.mode == overloadReject {
+		rw.Header().Add("X-Chaos-Injected-Concurrency", fmt.Sprintf("%d in flight (%s)", inFlight, s.concurrency))
+		http.Error(rw, "Service Unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+
+	d := time.Duration(inFlight-s.concurrency.limit) * s.concurrency.delay
+	if elapsed, err := s.wait(r, d); err != nil {
+		rw.Header().Add("X-Chaos-Injected-Concurrency", fmt.Sprintf("%d in flight (%s, cancelled after %s)",
+			inFlight, s.concurrency, elapsed))
+		return false
+	}
+	rw.Header().Add("X-Chaos-Injected-Concurrency", fmt.Sprintf("%d in flight (%s, delay: %s)",
+		inFlight, s.concurrency, d))
+
+	return true
+}
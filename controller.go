@@ -5,20 +5,69 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type chaosController struct {
+	// Number of requests currently blackholed and maximum number of concurrently blackholed requests, must remain
+	// first fields to ensure 64-bit alignment required by atomic operations on 32-bit platforms.
+	blackholed    int64
+	maxBlackholed int64
+
 	server *http.Server
+
+	// Current routing table, atomically swapped on updates so that requests are routed without locking.
+	table atomic.Value
+
+	// Seed the decision streams of the specs not featuring their own seed are derived from, random if not seeded.
+	seed   int64
+	seeded bool
+
+	// Serializes the routing table updates.
+	sync.Mutex
+}
+
+// routingTable represents an immutable snapshot of the controller routes.
+type routingTable struct {
 	routes map[string]*spec
 
-	sync.RWMutex
+	// Routes specs, ordered by decreasing precedence.
+	specs []*spec
+}
+
+func newRoutingTable(routes map[string]*spec) *routingTable {
+	t := routingTable{
+		routes: routes,
+		specs:  make([]*spec, 0, len(routes)),
+	}
+
+	for _, s := range routes {
+		t.specs = append(t.specs, s)
+	}
+
+	sort.Slice(t.specs, func(i, j int) bool { return t.specs[i].moreSpecific(t.specs[j]) })
+
+	return &t
+}
+
+func newChaosController() *chaosController {
+	c := chaosController{maxBlackholed: DefaultMaxBlackholed}
+	c.table.Store(newRoutingTable(nil))
+
+	return &c
 }
 
 func (c *chaosController) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	var (
-		method string
-		path   string
+		method    string
+		methods   []string
+		path      string
+		pathRegex string
+		err       error
 	)
 
 	if method = r.URL.Query().Get("method"); method == "" {
@@ -26,20 +75,34 @@ func (c *chaosController) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if path = r.URL.Query().Get("path"); path == "" {
+	if methods, err = parseMethods(method); err != nil {
+		http.Error(rw, fmt.Sprintf("Invalid method parameter: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	path = r.URL.Query().Get("path")
+	pathRegex = r.URL.Query().Get("path_regex")
+
+	if path != "" && pathRegex != "" {
+		http.Error(rw, "Parameters path and path_regex are mutually exclusive", http.StatusBadRequest)
+		return
+	}
+
+	// The route regex selector of a spec being set is specified in the request body.
+	if path == "" && pathRegex == "" && r.Method != "PUT" {
 		http.Error(rw, "Missing value for path parameter", http.StatusBadRequest)
 		return
 	}
 
 	switch r.Method {
 	case "GET":
-		c.getRouteChaosSpec(rw, r, method, path)
+		c.getRouteChaosSpec(rw, r, methods, selector(path, pathRegex))
 
 	case "PUT":
-		c.setRouteChaosSpec(rw, r, method, path)
+		c.setRouteChaosSpec(rw, r, methods, path)
 
 	case "DELETE":
-		c.delRouteChaosSpec(rw, r, method, path)
+		c.delRouteChaosSpec(rw, r, methods, selector(path, pathRegex))
 		return
 
 	default:
@@ -48,7 +111,7 @@ func (c *chaosController) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (c *chaosController) setRouteChaosSpec(rw http.ResponseWriter, r *http.Request, method, path string) {
+func (c *chaosController) setRouteChaosSpec(rw http.ResponseWriter, r *http.Request, methods []string, path string) {
 	var cs spec
 
 	data, err := ioutil.ReadAll(r.Body)
@@ -62,48 +125,297 @@ func (c *chaosController) setRouteChaosSpec(rw http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	c.Lock()
-	c.routes[method+path] = &cs
-	c.Unlock()
+	switch {
+	case cs.pathRegex != nil && path != "":
+		http.Error(rw, "Parameter path and spec path_regex are mutually exclusive", http.StatusBadRequest)
+		return
+
+	case cs.pathRegex == nil && path == "":
+		http.Error(rw, "Missing value for path parameter", http.StatusBadRequest)
+		return
+
+	case cs.pathRegex == nil:
+		if cs.path, err = parsePathPattern(path); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid path parameter: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	cs.methods = methods
+
+	c.update(func(routes map[string]*spec) {
+		seed := cs.seed
+		if !cs.seeded {
+			seed = deriveSeed(c.seed, cs.key())
+			if !c.seeded {
+				seed = time.Now().UnixNano()
+			}
+		}
+		cs.setSeed(seed)
+
+		routes[cs.key()] = &cs
+	})
 
 	rw.WriteHeader(http.StatusNoContent)
 }
 
-func (c *chaosController) getRouteChaosSpec(rw http.ResponseWriter, r *http.Request, method, path string) {
-	c.RLock()
-	spec, ok := c.routes[method+path]
-	c.RUnlock()
+func (c *chaosController) getRouteChaosSpec(rw http.ResponseWriter, r *http.Request, methods []string, selector string) {
+	spec, ok := c.routes().routes[formatMethods(methods)+selector]
 	if !ok {
 		http.Error(rw, "No such route", http.StatusNotFound)
 		return
 	}
 
+	if len(spec.hosts) > 0 {
+		fmt.Fprintf(rw, "Hosts: %s\n", strings.Join(spec.hosts, ", "))
+	}
+
+	if len(spec.sourceCIDRs) > 0 {
+		cidrs := make([]string, len(spec.sourceCIDRs))
+		for i, network := range spec.sourceCIDRs {
+			cidrs[i] = network.String()
+		}
+
+		fmt.Fprintf(rw, "Source CIDRs: %s (X-Forwarded-For depth: %d)\n", strings.Join(cidrs, ", "), spec.xffDepth)
+	}
+
+	if spec.match != nil {
+		for _, line := range spec.match.describe() {
+			fmt.Fprintf(rw, "Match: %s\n", line)
+		}
+	}
+
 	if spec.delay != nil {
-		fmt.Fprintf(rw, "Delay: %s (probability: %.1f)\n", spec.delay.duration, spec.delay.probability)
+		fmt.Fprintf(rw, "Delay: %s (%s)\n", spec.delay, spec.delay.details())
+	}
+
+	if spec.delay != nil && spec.delay.ramp != nil {
+		now := time.Now()
+
+		fmt.Fprintf(rw, "Delay ramp: %s (progress: %.0f%%, probability: %.2f",
+			spec.delay.ramp, spec.delay.ramp.progress(now)*100, spec.delay.currentProbability(now))
+		if spec.delay.ramp.duration != nil {
+			fmt.Fprintf(rw, ", duration: %s", spec.delay.currentDuration(now))
+		}
+		fmt.Fprintln(rw, ")")
+	}
+
+	if spec.throttle != nil {
+		fmt.Fprintf(rw, "Throttle: %s (probability: %.1f)\n", spec.throttle, spec.throttle.probability)
+	}
+
+	if spec.abort != nil {
+		fmt.Fprintf(rw, "Abort: %s (probability: %.1f)\n", spec.abort, spec.abort.probability)
+	}
+
+	if aborted := atomic.LoadUint64(&spec.aborted); aborted > 0 {
+		fmt.Fprintf(rw, "Aborted: %d connections aborted\n", aborted)
+	}
+
+	if spec.corruption != nil {
+		fmt.Fprintf(rw, "Corruption: %s (probability: %.1f)\n", spec.corruption, spec.corruption.probability)
+	}
+
+	if spec.blackhole != nil {
+		fmt.Fprintf(rw, "Blackhole: %s (probability: %.1f)\n", spec.blackhole, spec.blackhole.probability)
+	}
+
+	if blackholed := atomic.LoadInt64(&spec.blackholed); blackholed > 0 {
+		fmt.Fprintf(rw, "Blackholed: %d requests currently held\n", blackholed)
+	}
+
+	if disconnected := atomic.LoadUint64(&spec.disconnected); disconnected > 0 {
+		fmt.Fprintf(rw, "Blackhole released: %d requests released by client disconnect\n", disconnected)
 	}
 
 	if spec.err != nil {
-		fmt.Fprintf(rw, "Error: %d %q (probability: %.1f)\n",
-			spec.err.statusCode, spec.err.message, spec.err.probability)
+		for _, o := range spec.err.outcomes {
+			if len(spec.err.outcomes) > 1 {
+				fmt.Fprintf(rw, "Error: %d %q (probability: %.1f, weight: %g)\n",
+					o.statusCode, o.message, spec.err.probability, o.weight)
+			} else {
+				fmt.Fprintf(rw, "Error: %d %q (probability: %.1f)\n",
+					o.statusCode, o.message, spec.err.probability)
+			}
+
+			for name, value := range o.headers {
+				fmt.Fprintf(rw, "Error header: %s: %s (%d)\n", name, value, o.statusCode)
+			}
+		}
+
+		if spec.err.ramp != nil {
+			now := time.Now()
+
+			fmt.Fprintf(rw, "Error ramp: %s (progress: %.0f%%, probability: %.2f)\n",
+				spec.err.ramp, spec.err.ramp.progress(now)*100, spec.err.currentProbability(now))
+		}
+
+		for name, value := range spec.err.headers {
+			fmt.Fprintf(rw, "Error header: %s: %s\n", name, value)
+		}
+
+		if spec.err.contentType != "" {
+			fmt.Fprintf(rw, "Error content type: %s\n", spec.err.contentType)
+		}
+
+		if spec.err.body != nil {
+			fmt.Fprintf(rw, "Error body: %q\n", spec.err.body.Root.String())
+		}
+
+		if spec.err.rawBody != nil {
+			fmt.Fprintf(rw, "Error raw body: %q\n", *spec.err.rawBody)
+		}
+	}
+
+	if spec.sequence != nil {
+		sequences, position := spec.sequence.state()
+
+		fmt.Fprintf(rw, "Sequence: %s\n", spec.sequence)
+		if spec.sequence.key != nil {
+			fmt.Fprintf(rw, "Sequence position: %d tracked (least advanced: %d/%d)\n",
+				sequences, position, len(spec.sequence.steps))
+		} else {
+			fmt.Fprintf(rw, "Sequence position: %d/%d\n", position, len(spec.sequence.steps))
+		}
+	}
+
+	if spec.rateLimit != nil {
+		buckets, exhausted, tokens := spec.rateLimit.state(time.Now())
+
+		fmt.Fprintf(rw, "Rate limit: %s\n", spec.rateLimit)
+		if spec.rateLimit.key != nil {
+			fmt.Fprintf(rw, "Rate limit buckets: %d tracked, %d exhausted (lowest: %.1f tokens)\n",
+				buckets, exhausted, tokens)
+		} else {
+			fmt.Fprintf(rw, "Rate limit bucket: %.1f/%d tokens available\n", tokens, spec.rateLimit.burst)
+		}
+	}
+
+	if spec.concurrency != nil {
+		fmt.Fprintf(rw, "Concurrency: %s\n", spec.concurrency)
+		fmt.Fprintf(rw, "In flight: %d requests (%d overloaded)\n",
+			atomic.LoadInt64(&spec.inFlight), atomic.LoadUint64(&spec.overloaded))
+	}
+
+	if spec.requestMutation != nil {
+		fmt.Fprintf(rw, "Request mutation: %s (probability: %.1f)\n",
+			spec.requestMutation, spec.requestMutation.probability)
+	}
+
+	if spec.responseMutation != nil {
+		fmt.Fprintf(rw, "Response mutation: %s (probability: %.1f)\n",
+			spec.responseMutation, spec.responseMutation.probability)
+	}
+
+	if spec.sampling != nil {
+		fmt.Fprintf(rw, "Sampling: %s\n", spec.sampling)
+	}
+
+	if cancelled := atomic.LoadUint64(&spec.cancelled); cancelled > 0 {
+		fmt.Fprintf(rw, "Cancelled: %d requests cancelled during injection\n", cancelled)
+	}
+
+	if spec.maxInjections > 0 {
+		remaining := spec.maxInjections - atomic.LoadInt64(&spec.injections)
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		fmt.Fprintf(rw, "Injections: %d/%d remaining\n", remaining, spec.maxInjections)
+	} else if injections := atomic.LoadInt64(&spec.injections); injections > 0 {
+		fmt.Fprintf(rw, "Injections: %d\n", injections)
+	}
+
+	if spec.intervalBudget != nil {
+		remaining, reset := spec.intervalBudget.remaining(time.Now())
+
+		fmt.Fprintf(rw, "Injections per interval: %d/%d remaining (%s", remaining, spec.intervalBudget.max,
+			spec.intervalBudget)
+		if reset > 0 {
+			fmt.Fprintf(rw, ", reset in %s", reset.Round(time.Millisecond))
+		}
+		fmt.Fprintln(rw, ")")
+	}
+
+	if !spec.startAt.IsZero() {
+		fmt.Fprintf(rw, "Start: %s\n", spec.startAt)
 	}
 
 	if !spec.until.IsZero() {
 		fmt.Fprintf(rw, "Until: %s\n", spec.until)
 	}
+
+	if spec.schedule != nil {
+		fmt.Fprintf(rw, "Schedule: %s (active: %t)\n", spec.schedule, spec.schedule.active(time.Now()))
+	}
+
+	if spec.cycle != nil {
+		now := time.Now()
+
+		phase := "off"
+		on, next := spec.cycle.phase(now)
+		if on {
+			phase = "on"
+		}
+
+		fmt.Fprintf(rw, "Cycle: %s (phase: %s, next transition in %s)\n",
+			spec.cycle, phase, next.Sub(now).Round(time.Millisecond))
+	}
+
+	fmt.Fprintf(rw, "Seed: %d (decisions: %d)\n", spec.seed, atomic.LoadUint64(&spec.decisions))
 }
 
-func (c *chaosController) delRouteChaosSpec(rw http.ResponseWriter, r *http.Request, method, path string) {
-	c.RLock()
-	_, ok := c.routes[method+path]
-	c.RUnlock()
-	if !ok {
+func (c *chaosController) delRouteChaosSpec(rw http.ResponseWriter, r *http.Request, methods []string, selector string) {
+	if _, ok := c.routes().routes[formatMethods(methods)+selector]; !ok {
 		http.Error(rw, "No such endpoint", http.StatusNotFound)
 		return
 	}
 
-	c.Lock()
-	delete(c.routes, method+path)
-	c.Unlock()
+	c.update(func(routes map[string]*spec) {
+		delete(routes, formatMethods(methods)+selector)
+	})
 
 	rw.WriteHeader(http.StatusNoContent)
 }
+
+// routes returns the current controller routing table.
+func (c *chaosController) routes() *routingTable {
+	return c.table.Load().(*routingTable)
+}
+
+// update applies the function f to a copy of the controller routes, and publishes the resulting routing table. The
+// updates are serialized, f being called with the controller lock held.
+func (c *chaosController) update(f func(routes map[string]*spec)) {
+	c.Lock()
+	defer c.Unlock()
+
+	current := c.routes().routes
+	routes := make(map[string]*spec, len(current)+1)
+	for k, s := range current {
+		routes[k] = s
+	}
+
+	f(routes)
+
+	c.table.Store(newRoutingTable(routes))
+}
+
+// expire deletes the spec s from the controller routes, unless it has already been replaced.
+func (c *chaosController) expire(s *spec) {
+	c.update(func(routes map[string]*spec) {
+		if routes[s.key()] == s {
+			delete(routes, s.key())
+		}
+	})
+}
+
+// lookup returns the most specific chaos spec matching the HTTP request r, or nil if no spec matches.
+func (c *chaosController) lookup(r *http.Request) *spec {
+	for _, s := range c.routes().specs {
+		if s.matches(r) {
+			return s
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+// Supported corruption modes.
+const (
+	corruptTruncate      = "truncate"
+	corruptFlip          = "flip"
+	corruptGarbage       = "garbage"
+	corruptContentLength = "content_length"
+)
+
+type corruptionSpec struct {
+	mode        string
+	bytes       int
+	percent     float64
+	probability float64
+}
+
+func (s *corruptionSpec) UnmarshalJSON(data []byte) error {
+	corruptionSpec := struct {
+		Mode        string  `json:"mode"`
+		Bytes       int     `json:"bytes"`
+		Percent     float64 `json:"percent"`
+		Probability float64 `json:"p"`
+	}{}
+
+	if err := json.Unmarshal(data, &corruptionSpec); err != nil {
+		return err
+	}
+
+	s.mode = corruptionSpec.Mode
+	s.bytes = corruptionSpec.Bytes
+	s.percent = corruptionSpec.Percent
+	s.probability = corruptionSpec.Probability
+
+	switch s.mode {
+	case corruptTruncate:
+		if (s.bytes > 0) == (s.percent > 0) || s.bytes < 0 || s.percent < 0 || s.percent >= 100 {
+			return fmt.Errorf("corruption truncate mode requires either bytes > 0 or 0 < percent < 100 parameter")
+		}
+
+	case corruptFlip, corruptGarbage:
+		if s.bytes < 0 {
+			return fmt.Errorf("corruption bytes parameter value must be positive")
+		}
+
+		if s.bytes == 0 {
+			s.bytes = 1
+		}
+
+	case corruptContentLength:
+		if s.bytes == 0 {
+			s.bytes = 1
+		}
+
+	default:
+		return fmt.Errorf("corruption mode parameter value must be one of truncate, flip, garbage or content_length")
+	}
+
+	if s.probability < 0 || s.probability > 1 {
+		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
+	}
+
+	return nil
+}
+
+func (s *corruptionSpec) String() string {
+	switch s.mode {
+	case corruptTruncate:
+		if s.percent > 0 {
+			return fmt.Sprintf("truncate after %g%%", s.percent)
+		}
+		return fmt.Sprintf("truncate after %d B", s.bytes)
+
+	case corruptFlip:
+		return fmt.Sprintf("flip %d B", s.bytes)
+
+	case corruptGarbage:
+		return fmt.Sprintf("garbage %d B", s.bytes)
+
+	default:
+		return fmt.Sprintf("content_length %+d B", s.bytes)
+	}
+}
+
+func (s *spec) injectCorruption(r *http.Request, rnd *rand.Rand) bool {
+	return s.corruption != nil && s.sample(r, rnd, "corruption", s.corruption.probability)
+}
+
+// corrupt returns the corrupted version of the response body, and the advertised response body length.
+func (s *corruptionSpec) corrupt(body []byte, rnd *rand.Rand) ([]byte, int) {
+	switch s.mode {
+	case corruptTruncate:
+		n := s.bytes
+		if s.percent > 0 {
+			n = int(float64(len(body)) * s.percent / 100)
+		}
+
+		if n < len(body) {
+			body = body[:n]
+		}
+
+	case corruptFlip:
+		if len(body) > 0 {
+			for i := 0; i < s.bytes; i++ {
+				body[rnd.Intn(len(body))] ^= byte(1 << uint(rnd.Intn(8)))
+			}
+		}
+
+	case corruptGarbage:
+		garbage := make([]byte, s.bytes)
+		rnd.Read(garbage)
+
+		i := rnd.Intn(len(body) + 1)
+		body = append(body[:i], append(garbage, body[i:]...)...)
+
+	case corruptContentLength:
+		if n := len(body) + s.bytes; n >= 0 {
+			return body, n
+		}
+		return body, 0
+	}
+
+	return body, len(body)
+}
+
+// corruptResponseWriter is a http.ResponseWriter holding the response body written by the downstream handler in
+// order to corrupt it before sending it to the client.
+type corruptResponseWriter struct {
+	http.ResponseWriter
+
+	spec   *spec
+	rnd    *rand.Rand
+	status int
+	buf    bytes.Buffer
+}
+
+func newCorruptResponseWriter(rw http.ResponseWriter, spec *spec, rnd *rand.Rand) *corruptResponseWriter {
+	return &corruptResponseWriter{
+		ResponseWriter: rw,
+		spec:           spec,
+		rnd:            rnd,
+	}
+}
+
+func (w *corruptResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *corruptResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.buf.Write(data)
+}
+
+// Flush is a no-op since the whole response is held until the downstream handler returned.
+func (w *corruptResponseWriter) Flush() {}
+
+func (w *corruptResponseWriter) finish() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	body, length := w.spec.corruption.corrupt(w.buf.Bytes(), w.rnd)
+
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Length", strconv.Itoa(length))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+
+	finishResponse(w.ResponseWriter)
+}
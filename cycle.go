@@ -0,0 +1,123 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// cycleSpec represents an intermittent activity of the spec effects, alternating "on" periods during which they are
+// enforced and "off" periods. Each cycle starts with an "on" period, whose end can be randomly shifted by up to the
+// jitter duration while keeping the cycles period constant.
+type cycleSpec struct {
+	on     time.Duration
+	off    time.Duration
+	jitter time.Duration
+	offset time.Duration
+	start  time.Time
+	seed   int64
+}
+
+func (s *cycleSpec) UnmarshalJSON(data []byte) error {
+	cycleSpec := struct {
+		On     string `json:"on"`
+		Off    string `json:"off"`
+		Jitter string `json:"jitter"`
+		Offset string `json:"offset"`
+	}{}
+
+	if err := json.Unmarshal(data, &cycleSpec); err != nil {
+		return err
+	}
+
+	s.start = time.Now()
+
+	for _, d := range []struct {
+		name     string
+		value    string
+		duration *time.Duration
+		required bool
+	}{
+		{"on", cycleSpec.On, &s.on, true},
+		{"off", cycleSpec.Off, &s.off, true},
+		{"jitter", cycleSpec.Jitter, &s.jitter, false},
+		{"offset", cycleSpec.Offset, &s.offset, false},
+	} {
+		if d.value == "" && !d.required {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid value for cycle %s parameter: %s", d.name, err)
+		}
+
+		if duration < 0 || (d.required && duration == 0) {
+			return fmt.Errorf("cycle %s parameter value must be greater than 0 ", d.name)
+		}
+
+		*d.duration = duration
+	}
+
+	return nil
+}
+
+func (s *cycleSpec) String() string {
+	desc := fmt.Sprintf("on %s, off %s", s.on, s.off)
+
+	if s.jitter > 0 {
+		desc += fmt.Sprintf(", jitter %s", s.jitter)
+	}
+
+	if s.offset > 0 {
+		desc += fmt.Sprintf(", offset %s", s.offset)
+	}
+
+	return desc
+}
+
+// phase returns true if the cycle is in an "on" period at time now, along with the time of the next transition.
+func (s *cycleSpec) phase(now time.Time) (bool, time.Time) {
+	var (
+		period  = s.on + s.off
+		elapsed = now.Sub(s.start) + s.offset
+		n       = int64(elapsed / period)
+	)
+
+	if elapsed < 0 && elapsed%period != 0 {
+		n--
+	}
+
+	var (
+		pos        = elapsed - time.Duration(n)*period
+		transition = s.on + s.shift(n)
+	)
+
+	if pos < transition {
+		return true, now.Add(transition - pos)
+	}
+
+	return false, now.Add(period - pos)
+}
+
+// shift returns the random shift of the end of the "on" period of the cycle n, deterministically derived from n and
+// the spec seed so that the phase of the cycle is consistent over time and reproducible.
+func (s *cycleSpec) shift(n int64) time.Duration {
+	if s.jitter == 0 {
+		return 0
+	}
+
+	x := mix64(uint64(n) + uint64(s.seed) + 0x9e3779b97f4a7c15)
+
+	shift := time.Duration((float64(x>>11)/(1<<53)*2 - 1) * float64(s.jitter))
+
+	switch {
+	case s.on+shift < 0:
+		return -s.on
+
+	case shift > s.off:
+		return s.off
+	}
+
+	return shift
+}
@@ -1,49 +1,435 @@
 package chaos
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// Supported delay distributions.
+const (
+	delayFixed       = "fixed"
+	delayUniform     = "uniform"
+	delayNormal      = "normal"
+	delayExponential = "exponential"
+	delayPareto      = "pareto"
+	delayPercentiles = "percentiles"
+)
+
+// Supported delay phases.
+const (
+	delayBefore          = "before"
+	delayAfter           = "after"
+	delayTimeToFirstByte = "time_to_first_byte"
+)
+
 type delaySpec struct {
-	duration    time.Duration
-	probability float64
+	distribution string
+	duration     time.Duration
+	min          float64
+	max          float64
+	mean         float64
+	stddev       float64
+	scale        float64
+	shape        float64
+	percentiles  []percentile
+	phase        string
+	probability  float64
+	ramp         *rampSpec
+}
+
+// percentile represents a delay distribution point: p is the percentile (between 0 and 100) and v the corresponding
+// delay value in milliseconds.
+type percentile struct {
+	p float64
+	v float64
 }
 
 func (s *delaySpec) UnmarshalJSON(data []byte) error {
 	delaySpec := struct {
-		Duration    int     `json:"duration"`
-		Probability float64 `json:"p"`
+		Distribution string             `json:"distribution"`
+		Duration     int                `json:"duration"`
+		Min          float64            `json:"min"`
+		Max          float64            `json:"max"`
+		Mean         float64            `json:"mean"`
+		StdDev       float64            `json:"stddev"`
+		Scale        float64            `json:"scale"`
+		Shape        float64            `json:"shape"`
+		Percentiles  map[string]float64 `json:"percentiles"`
+		Phase        string             `json:"phase"`
+		Probability  float64            `json:"p"`
+		Ramp         *rampSpec          `json:"ramp"`
 	}{}
 
 	if err := json.Unmarshal(data, &delaySpec); err != nil {
 		return err
 	}
 
+	s.distribution = delaySpec.Distribution
 	s.duration = time.Duration(delaySpec.Duration) * time.Millisecond
+	s.min = delaySpec.Min
+	s.max = delaySpec.Max
+	s.mean = delaySpec.Mean
+	s.stddev = delaySpec.StdDev
+	s.scale = delaySpec.Scale
+	s.shape = delaySpec.Shape
+	s.phase = delaySpec.Phase
 	s.probability = delaySpec.Probability
+	s.ramp = delaySpec.Ramp
+
+	if s.distribution == "" {
+		s.distribution = delayFixed
+	}
+
+	switch s.phase {
+	case "":
+		s.phase = delayBefore
+
+	case delayBefore, delayAfter, delayTimeToFirstByte:
+
+	default:
+		return fmt.Errorf("delay phase parameter value must be one of before, after or time_to_first_byte")
+	}
+
+	if s.min < 0 || s.max < 0 || (s.max > 0 && s.max < s.min) {
+		return fmt.Errorf("delay min and max parameter values must be 0 <= min <= max")
+	}
+
+	switch s.distribution {
+	case delayFixed:
+		if delaySpec.Duration <= 0 {
+			return fmt.Errorf("delay duration parameter value must be greater than 0 ")
+		}
+
+	case delayUniform:
+		if s.max <= 0 {
+			return fmt.Errorf("delay max parameter value must be greater than 0 ")
+		}
+
+	case delayNormal:
+		if s.mean <= 0 || s.stddev < 0 {
+			return fmt.Errorf("delay mean parameter value must be greater than 0 and stddev positive")
+		}
+
+	case delayExponential:
+		if s.mean <= 0 {
+			return fmt.Errorf("delay mean parameter value must be greater than 0 ")
+		}
+
+	case delayPareto:
+		if s.scale <= 0 || s.shape <= 0 {
+			return fmt.Errorf("delay scale and shape parameter values must be greater than 0 ")
+		}
+
+	case delayPercentiles:
+		if len(delaySpec.Percentiles) == 0 {
+			return fmt.Errorf("delay percentiles parameter value must not be empty")
+		}
+
+		for k, v := range delaySpec.Percentiles {
+			p, err := strconv.ParseFloat(strings.TrimPrefix(k, "p"), 64)
+			if err != nil || !strings.HasPrefix(k, "p") || p < 0 || p > 100 {
+				return fmt.Errorf("invalid delay percentile %q: must be expressed as pN with 0 <= N <= 100", k)
+			}
+
+			if v < 0 {
+				return fmt.Errorf("delay percentile %q value must be positive", k)
+			}
+
+			s.percentiles = append(s.percentiles, percentile{p: p, v: v})
+		}
+
+		sort.Slice(s.percentiles, func(i, j int) bool { return s.percentiles[i].p < s.percentiles[j].p })
+
+		for i := 1; i < len(s.percentiles); i++ {
+			if s.percentiles[i].v < s.percentiles[i-1].v {
+				return fmt.Errorf("delay percentiles values must increase with percentiles")
+			}
+		}
 
-	if delaySpec.Duration <= 0 {
-		return fmt.Errorf("delay duration parameter value must be greater than 0 ")
+	default:
+		return fmt.Errorf("unsupported delay distribution %q", s.distribution)
 	}
 
 	if s.probability < 0 || s.probability > 1 {
 		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
 	}
 
+	if s.ramp != nil && s.ramp.duration != nil && s.distribution != delayFixed {
+		return fmt.Errorf("delay ramp duration_from parameter is only supported with fixed distribution")
+	}
+
 	return nil
 }
 
-func (s *spec) injectDelay() bool {
+// currentProbability returns the delay probability at time now, taking the delay ramp into account.
+func (s *delaySpec) currentProbability(now time.Time) float64 {
+	return s.ramp.rampProbability(s.probability, now)
+}
+
+// currentDuration returns the fixed delay duration at time now, taking the delay ramp into account.
+func (s *delaySpec) currentDuration(now time.Time) time.Duration {
+	return s.ramp.rampDuration(s.duration, now)
+}
+
+// sample returns a delay duration sampled from the delay distribution.
+func (s *delaySpec) sample(rnd *rand.Rand) time.Duration {
+	var ms float64
+
+	switch s.distribution {
+	case delayFixed:
+		return s.currentDuration(time.Now())
+
+	case delayUniform:
+		ms = s.min + rnd.Float64()*(s.max-s.min)
+
+	case delayNormal:
+		ms = s.mean + rnd.NormFloat64()*s.stddev
+
+	case delayExponential:
+		ms = rnd.ExpFloat64() * s.mean
+
+	case delayPareto:
+		ms = s.scale / math.Pow(1-rnd.Float64(), 1/s.shape)
+
+	case delayPercentiles:
+		ms = s.quantile(rnd.Float64() * 100)
+	}
+
+	if ms < s.min {
+		ms = s.min
+	}
+
+	if s.max > 0 && ms > s.max {
+		ms = s.max
+	}
+
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond)
+}
+
+// quantile returns the delay value in milliseconds corresponding to the percentile p, linearly interpolated between
+// the distribution percentiles. Below the lowest percentile the interpolation starts from the min value, and above
+// the highest percentile it ends at the max value if set.
+func (s *delaySpec) quantile(p float64) float64 {
+	points := s.percentiles
+
+	if points[0].p > 0 {
+		points = append([]percentile{{p: 0, v: math.Min(s.min, points[0].v)}}, points...)
+	}
+
+	if last := points[len(points)-1]; last.p < 100 {
+		points = append(points, percentile{p: 100, v: math.Max(s.max, last.v)})
+	}
+
+	for i := 1; i < len(points); i++ {
+		if p <= points[i].p {
+			lo, hi := points[i-1], points[i]
+			if hi.p == lo.p {
+				return hi.v
+			}
+
+			return lo.v + (p-lo.p)/(hi.p-lo.p)*(hi.v-lo.v)
+		}
+	}
+
+	return points[len(points)-1].v
+}
+
+func (s *delaySpec) String() string {
+	var desc string
+
+	switch s.distribution {
+	case delayFixed:
+		desc = s.duration.String()
+
+	case delayUniform:
+		desc = fmt.Sprintf("uniform %s-%s", msDuration(s.min), msDuration(s.max))
+
+	case delayNormal:
+		desc = fmt.Sprintf("normal mean %s stddev %s", msDuration(s.mean), msDuration(s.stddev))
+
+	case delayExponential:
+		desc = fmt.Sprintf("exponential mean %s", msDuration(s.mean))
+
+	case delayPareto:
+		desc = fmt.Sprintf("pareto scale %s shape %g", msDuration(s.scale), s.shape)
+
+	case delayPercentiles:
+		points := make([]string, len(s.percentiles))
+		for i, p := range s.percentiles {
+			points[i] = fmt.Sprintf("p%g=%s", p.p, msDuration(p.v))
+		}
+		desc = "percentiles " + strings.Join(points, " ")
+	}
+
+	if s.distribution != delayFixed && s.distribution != delayUniform {
+		if s.min > 0 {
+			desc += fmt.Sprintf(" min %s", msDuration(s.min))
+		}
+
+		if s.max > 0 {
+			desc += fmt.Sprintf(" max %s", msDuration(s.max))
+		}
+	}
+
+	return desc
+}
+
+// details returns the description of the delay injection parameters.
+func (s *delaySpec) details() string {
+	if s.phase != delayBefore {
+		return fmt.Sprintf("probability: %.1f, phase: %s", s.currentProbability(time.Now()), s.phase)
+	}
+
+	return fmt.Sprintf("probability: %.1f", s.currentProbability(time.Now()))
+}
+
+// msDuration converts a duration expressed in milliseconds to time.Duration.
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// sampleDelay returns a delay duration sampled from the spec delay distribution using the random number generator
+// rnd if the spec delay is sampled for the HTTP request r.
+func (s *spec) sampleDelay(r *http.Request, rnd *rand.Rand) (time.Duration, bool) {
 	if s.delay != nil {
-		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-		if p := rnd.Float64(); p > 1-s.delay.probability {
-			time.Sleep(s.delay.duration)
-			return true
+		if s.sample(r, rnd, "delay", s.delay.currentProbability(time.Now())) {
+			return s.delay.sample(rnd), true
+		}
+	}
+
+	return 0, false
+}
+
+// wait stalls the processing of the HTTP request r for the duration d. If the request context is cancelled (e.g. the
+// client disconnected) during the wait, it stops early, records the cancellation and returns the elapsed time along
+// with the context error.
+func (s *spec) wait(r *http.Request, d time.Duration) (time.Duration, error) {
+	elapsed, err := sleep(r.Context(), d)
+	if err != nil {
+		atomic.AddUint64(&s.cancelled, 1)
+	}
+
+	return elapsed, err
+}
+
+// sleep pauses the current goroutine for the duration d, or until the context ctx is done. It returns the actual
+// time elapsed, and the context error if it was done before the end of the duration.
+func sleep(ctx context.Context, d time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return d, nil
+
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// delayedResponseWriter is a http.ResponseWriter delaying the response sent to the client once the downstream handler
+// started writing it: in "after" phase the whole response is held until the handler returned, in
+// "time_to_first_byte" phase the first write is delayed.
+type delayedResponseWriter struct {
+	http.ResponseWriter
+
+	spec    *spec
+	r       *http.Request
+	delay   time.Duration
+	status  int
+	buf     bytes.Buffer
+	delayed bool
+	err     error
+}
+
+func newDelayedResponseWriter(rw http.ResponseWriter, r *http.Request, spec *spec,
+	d time.Duration) *delayedResponseWriter {
+	return &delayedResponseWriter{
+		ResponseWriter: rw,
+		spec:           spec,
+		r:              r,
+		delay:          d,
+	}
+}
+
+// wait injects the delay unless it has already been injected, and returns a non-nil error if the request has been
+// cancelled during the delay.
+func (w *delayedResponseWriter) wait() error {
+	if !w.delayed {
+		w.delayed = true
+		_, w.err = w.spec.wait(w.r, w.delay)
+	}
+
+	return w.err
+}
+
+func (w *delayedResponseWriter) WriteHeader(statusCode int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = statusCode
+
+	if w.spec.delay.phase == delayTimeToFirstByte && w.wait() == nil {
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *delayedResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.spec.delay.phase == delayAfter {
+		return w.buf.Write(data)
+	}
+
+	if err := w.wait(); err != nil {
+		return 0, err
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *delayedResponseWriter) Flush() {
+	if w.spec.delay.phase == delayAfter {
+		return
+	}
+
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.wait() == nil {
+		flush(w.ResponseWriter)
+	}
+}
+
+func (w *delayedResponseWriter) finish() {
+	switch w.spec.delay.phase {
+	case delayAfter:
+		if w.wait() == nil {
+			if w.status != 0 {
+				w.ResponseWriter.WriteHeader(w.status)
+			}
+			w.ResponseWriter.Write(w.buf.Bytes())
 		}
+
+	case delayTimeToFirstByte:
+		// The downstream handler didn't write anything, the delay still applies to the implicit response.
+		w.wait()
 	}
 
-	return false
+	finishResponse(w.ResponseWriter)
 }
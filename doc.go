@@ -8,13 +8,33 @@ The Chaos Middleware is configurable on-the-fly via a dedicated management HTTP
 defining either or both a delay artificially stalling the request processing and an error terminating the request
 processing with an arbitrary status code and optional message.
 
-Configuration Routes
+# Configuration Routes
 
 For every configuration route, the following URL parameters are mandatory:
 
-	<method>: the HTTP method corresponding to the target route (e.g. "GET", "POST"...)
+	<method>: the HTTP method corresponding to the target route (e.g. "GET", "POST"...), a comma-separated list of
+	methods (e.g. "GET,POST") or "*" to match any method
 	<path>: the URL path corresponding to the target route, starting (e.g. "/api/a")
 
+The path parameter can also be a pattern matching several target routes:
+
+	/api/users/*            "*" matches any character except "/"
+	/api/users/{id}         gorilla/mux-style variable matching a single path segment
+	/api/users/{id:[0-9]+}  variable constrained by a regular expression
+	/api/**                 trailing "**" matches any number of remaining path segments
+
+When several chaos specifications match a request, the most specific one wins: the pattern with the most literal
+segments, then a pattern without trailing "**", then the pattern with the most segments, then the specification
+with the fewest methods ("*" coming last). Specifications set with a list of methods are retrieved and deleted using
+the same list, in any order.
+
+Alternatively, target routes can be selected using a regular expression matched against the URL path, set in the
+"path_regex" field of the chaos specification: in this case the path parameter must be omitted when setting the
+specification, and the "path_regex" URL parameter must be used in its place to get or delete it. Path patterns take
+precedence over regular expressions. The values of the regular expression named capture groups (e.g.
+"^/api/users/(?P<id>[0-9]+)$") are reported in the X-Chaos-Injected-Captures header of disrupted requests, and are
+available to error response body templates.
+
 The available routes are:
 
 	PUT /
@@ -26,14 +46,258 @@ content type must be "application/json":
 	  "error": {
 	    "status_code": <int: HTTP status code to return for request termination>,
 	    "message": "<string: optional message to return for request termination>",
+	    "outcomes": [<optional list of weighted error responses, replacing status_code and message>
+	      {
+	        "status_code": <int: HTTP status code to return for request termination>,
+	        "message": "<string: optional message to return for request termination>",
+	        "headers": {"<string: optional response header name>": "<string: header value>", ...},
+	        "weight": <float: optional outcome weight relative to the other outcomes (default: 1)>
+	      },
+	      ...
+	    ],
+	    "headers": {"<string: optional response header name>": "<string: header value>", ...},
+	    "content_type": "<string: optional response content type>",
+	    "body": "<string: optional response body template, replacing the message>",
+	    "raw_body": "<string: optional response body returned as is, replacing the message>",
+	    "ramp": {
+	      "p_from": <float: optional probability at the start of the ramp>,
+	      "over": "<string: ramp duration expressed in Go duration format>",
+	      "steps": <int: optional number of ramp steps (default: linear ramp)>
+	    },
 	    "p": <float: probability between 0 and 1>
 	  },
 	  "delay": {
 	    "duration": <int: delay duration in milliseconds>,
+	    "phase": "<string: optional delay phase, one of before (default), after or time_to_first_byte>",
+	    "ramp": {
+	      "p_from": <float: optional probability at the start of the ramp>,
+	      "duration_from": <int: optional fixed delay duration at the start of the ramp (in milliseconds)>,
+	      "over": "<string: ramp duration expressed in Go duration format>",
+	      "steps": <int: optional number of ramp steps (default: linear ramp)>
+	    },
 	    "p": <float: probability between 0 and 1>
+	  },
+	  "throttle": {
+	    "bps": <int: response bandwidth in bytes per second>,
+	    "chunk_size": <int: optional response chunk size in bytes>,
+	    "chunk_delay": <int: optional delay between response chunks in milliseconds>,
+	    "p": <float: probability between 0 and 1>
+	  },
+	  "abort": {
+	    "mode": "<string: connection abort mode, one of close, reset or partial>",
+	    "bytes": <int: optional number of response body bytes sent before closing in partial mode>,
+	    "p": <float: probability between 0 and 1>
+	  },
+	  "blackhole": {
+	    "max_hold": <int: optional maximum request hold time in milliseconds>,
+	    "p": <float: probability between 0 and 1>
+	  },
+	  "corruption": {
+	    "mode": "<string: response body corruption mode, one of truncate, flip, garbage or content_length>",
+	    "bytes": <int: number of bytes (see below)>,
+	    "percent": <float: percentage of the response body kept in truncate mode, in place of bytes>,
+	    "p": <float: probability between 0 and 1>
+	  },
+	  "sequence": {
+	    "steps": [
+	      {
+	        "type": "<string: step outcome, one of error, delay, pass or abort>",
+	        "status_code": <int: HTTP status code to return for request termination (error step)>,
+	        "message": "<string: optional message to return for request termination (error step)>",
+	        "duration": <int: delay duration in milliseconds (delay step)>,
+	        "mode": "<string: connection abort mode, one of close (default), reset or partial (abort step)>"
+	      },
+	      ...
+	    ],
+	    "loop": <bool: optional restart of the sequence once over>,
+	    "key": "<string: optional per-client sequence key, one of header, cookie, query or client_ip>",
+	    "name": "<string: header, cookie or query parameter name of the sequence key>"
+	  },
+	  "rate_limit": {
+	    "rate": <float: token bucket refill rate in requests per second>,
+	    "burst": <int: optional token bucket capacity (default: the rate rounded up)>,
+	    "key": "<string: optional per-client bucket key, one of header, cookie, query or client_ip>",
+	    "name": "<string: header, cookie or query parameter name of the bucket key>"
+	  },
+	  "concurrency": {
+	    "limit": <int: maximum number of requests concurrently in flight before overload>,
+	    "mode": "<string: overload mode, one of delay or reject>",
+	    "delay": <int: delay per request in flight beyond the limit in delay mode (in milliseconds)>
+	  },
+	  "request_mutation": {
+	    "add_headers": {"<string: header name>": "<string: value added to the request header>", ...},
+	    "set_headers": {"<string: header name>": "<string: value replacing the request header>", ...},
+	    "remove_headers": ["<string: name of the header removed from the request>", ...],
+	    "set_query": {"<string: query parameter name>": "<string: value replacing the parameter>", ...},
+	    "remove_query": ["<string: name of the query parameter removed from the request>", ...],
+	    "body": "<string: value replacing the request body>",
+	    "p": <float: probability between 0 and 1>
+	  },
+	  "response_mutation": {
+	    "set_headers": {"<string: header name>": "<string: value replacing the response header>", ...},
+	    "remove_headers": ["<string: name of the header removed from the response>", ...],
+	    "status_code": <int: HTTP status code replacing the status code of successful responses>,
+	    "p": <float: probability between 0 and 1>
+	  },
+	  "start_at": "<string: optional chaos effect start time expressed in RFC 3339 format>",
+	  "end_at": "<string: optional chaos effect end time expressed in RFC 3339 format>",
+	  "schedule": {
+	    "cron": "<string: recurring chaos effect windows start times expressed as a cron expression>",
+	    "duration": "<string: recurring chaos effect windows duration expressed in Go duration format>",
+	    "timezone": "<string: optional cron expression timezone (default: UTC)>"
+	  },
+	  "cycle": {
+	    "on": "<string: chaos effect on period duration expressed in Go duration format>",
+	    "off": "<string: chaos effect off period duration expressed in Go duration format>",
+	    "jitter": "<string: optional maximum random shift of the on periods end>",
+	    "offset": "<string: optional cycle phase offset>"
+	  },
+	  "max_injections": <int: optional maximum number of injections before the chaos specification expires>,
+	  "max_injections_per_interval": {
+	    "max": <int: maximum number of injections per interval>,
+	    "interval": "<string: interval expressed in Go duration format>"
+	  },
+	  "seed": <int: optional seed of the injection decisions random number generator>,
+	  "path_regex": "<string: optional URL path regular expression route selector>",
+	  "source_cidrs": ["<string: optional client network in CIDR notation or IP address>", ...],
+	  "xff_depth": <int: optional number of trusted X-Forwarded-For request header entries (default: 0)>,
+	  "hosts": ["<string: optional virtual host name or wildcard pattern (e.g. "*.example.net")>", ...],
+	  "sampling": {
+	    "key": "<string: sticky sampling key, one of header, cookie, query or client_ip>",
+	    "name": "<string: header, cookie or query parameter name>"
+	  },
+	  "match": {
+	    "headers": [<predicate>, ...],
+	    "query": [<predicate>, ...],
+	    "cookies": [<predicate>, ...]
 	  }
 	}
 
+The chaos specification effects are enforced from the optional "start_at" time (or immediately) until the optional
+"end_at" time, or for the optional "duration" relative to the start time. The optional "schedule" block further
+restricts them to recurring windows starting at the times matching a standard 5 fields cron expression (minute, hour,
+day of month, month and day of week) and lasting for the specified duration: for instance "15 * * * *" with a "5m"
+duration means every hour from :15 to :20, and "0 14 * * 1-5" with a "30m" duration means weekdays from 14:00 to
+14:30.
+
+The optional "cycle" block makes the chaos specification effects flap, alternating "on" periods during which they
+are enforced and "off" periods, starting with an "on" period shifted by the optional phase offset. The end of each
+"on" period can be randomly shifted by up to the optional jitter, the cycle period remaining constant. The current
+phase and the time until the next transition are reported by the GET configuration route.
+
+The optional "max_injections" and "max_injections_per_interval" parameters bound the number of requests the chaos
+specification effects are injected in, respectively in total (the chaos specification being deleted once the
+maximum is reached, e.g. to fail exactly the next 3 requests) and per fixed time interval. Requests beyond these
+budgets are processed normally. The remaining budgets are reported by the GET configuration route.
+
+The optional "seed" parameter sets the seed of the chaos specification injection decision stream (defaulting to
+a seed derived from the seed set with Chaos.SetSeed and the chaos specification route, or to a random seed), making
+its random injection decisions reproducible: the decisions regarding a request (sampling, delay duration, error
+outcome, corruption...) are derived from the seed and the index of the request in the stream only, both reported in
+the X-Chaos-Injected-Seed header, so that a failed chaos run can be replayed exactly by setting the same seed again.
+The "cycle" jitter is derived from the seed as well.
+
+The optional "source_cidrs" and "hosts" lists restrict the chaos specification effects to requests sent by clients
+belonging to one of the networks and to one of the virtual hosts respectively. The client address is the request remote
+address, unless "xff_depth" is set to the number of trusted proxies having appended an entry to the X-Forwarded-For
+request header: for instance with a depth of 1, the last entry of the X-Forwarded-For header is used.
+
+Instead of a single status code, the error injection can be set with a list of weighted outcomes: for each injected
+error, the response is one of the outcomes randomly chosen according to its weight relative to the other outcomes'
+weights, the chosen outcome being reported in the X-Chaos-Injected-Error header.
+
+The error response body is a Go text/template template (see https://golang.org/pkg/text/template/) where the
+{{.StatusCode}}, {{.Method}}, {{.Path}}, {{.RequestID}} and {{.Captures}} fields refer to the request being disrupted,
+the request ID being read from the X-Request-ID request header (or randomly generated if absent) and the captures
+being the values of the route path regular expression named capture groups (e.g. {{.Captures.id}}). The "raw_body"
+field can be used instead to return a body as is, without template processing. Its content type defaults to
+"text/plain; charset=utf-8".
+
+Instead of a fixed duration, the delay can be sampled from a distribution by setting its "distribution" field (all
+values being expressed in milliseconds):
+
+	{"distribution": "uniform", "min": <float>, "max": <float>}
+	{"distribution": "normal", "mean": <float>, "stddev": <float>}
+	{"distribution": "exponential", "mean": <float>}
+	{"distribution": "pareto", "scale": <float: minimum value>, "shape": <float>}
+	{"distribution": "percentiles", "percentiles": {"p50": <float>, "p99": <float>, ...}}
+
+Except for the uniform distribution, the sampled delay can be clamped using the optional "min" and "max" fields. The
+percentiles distribution is linearly interpolated between the specified percentiles.
+
+The optional delay and error "ramp" blocks make the probability (and the fixed delay duration) progressively ramp
+from their start values to their configured values over the ramp duration, starting with the chaos specification
+effects, either linearly or in the specified number of steps. The current values are reported by the GET
+configuration route.
+
+By default the delay stalls the request before it is processed by the next handler, simulating a slow server. The
+"after" phase holds the response produced by the next handler during the delay before sending it to the client, and
+the "time_to_first_byte" phase delays the first bytes of the response written by the next handler, simulating a slow
+network.
+
+The optional "throttle" block slowly drips the response body to the client, in chunks paced according to the
+bandwidth and/or the delay between chunks. The chunk size defaults to a tenth of the bandwidth (i.e. a chunk every
+100ms), or 1024 bytes if only the delay between chunks is set.
+
+The optional "abort" block interrupts the request processing by closing the client connection without response
+("close" mode), resetting it ("reset" mode, TLS connections being unwrapped) or closing it after sending the response
+headers and a part of the response body produced by the next handler ("partial" mode, half of the body by default).
+If the client connection cannot be hijacked (e.g. with HTTP/2) or reset (e.g. non-TCP connections), a "502 Bad
+Gateway" error is returned instead and the reason is reported in the X-Chaos-Injected-Abort response header. The number of aborted
+connections is reported by the GET configuration route.
+
+The optional "blackhole" block holds the request open without ever answering it, until the client disconnects or
+the maximum hold time is reached: in this case the client connection is closed. In order to prevent tests from
+exhausting the server resources, the number of concurrently blackholed requests is capped (see
+Chaos.SetMaxBlackholed): beyond this limit, a "503 Service Unavailable" error is returned instead and reported in the
+X-Chaos-Injected-Blackhole response header. The number of blackholed requests released by the client disconnecting is
+reported by the GET configuration route.
+
+The optional "corruption" block alters the response body produced by the next handler: "truncate" mode cuts it
+after the specified number of bytes (or percentage of the body), "flip" mode flips a random bit of the specified
+number of random bytes (default: 1), "garbage" mode inserts the specified number of random bytes (default: 1) at a
+random position and "content_length" mode advertises a Content-Length differing from the actual body length by the
+specified number of bytes (default: 1, negative values advertising a shorter body).
+
+The optional "sequence" block scripts the outcomes of successive requests, e.g. to test idempotent retries: each
+matching request consumes the next step of the sequence, answering the request with an error ("error" step),
+delaying it ("delay" step), letting it through ("pass" step) or aborting the client connection ("abort" step). Once
+the sequence is over requests are let through, unless "loop" is true in which case the sequence restarts. The
+sequence can progress independently per request key value (e.g. a client ID header or the client IP address).
+
+The optional "rate_limit" block emulates a rate limiting upstream using a token bucket, shared by all requests or
+maintained per request key value (e.g. a user ID header or the client IP address). Once the bucket is exhausted, a
+"429 Too Many Requests" error is returned with a Retry-After response header; the bucket state is reported in the
+X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset response headers, and by the GET configuration route.
+
+The optional "concurrency" block emulates a server degrading when too many requests are in flight on the route:
+beyond the limit, requests are either delayed proportionally to the number of requests in flight beyond the limit
+("delay" mode) or rejected with a "503 Service Unavailable" error ("reject" mode). The number of requests in flight
+is reported by the GET configuration route.
+
+The optional "request_mutation" block alters the request before it is processed by the next handler, e.g. to
+simulate a proxy stripping the Authorization header or rewriting the Host header (setting the "Host" header rewriting
+the request host). The optional "response_mutation" block alters the head of the response produced by the next
+handler, the status code being only replaced for successful (2xx) responses.
+
+By default the delay and error probabilities apply to each request independently. The optional "sampling" block
+makes them apply to a hash of the request sampling key value instead (e.g. a user ID header or the client IP
+address), so that a given value is consistently in or out of the chaos specification effects. Each effect of each
+chaos specification samples values independently of the others (the hash being salted with the chaos specification
+route, seed and effect). Requests lacking the sampling key value are sampled independently.
+
+The optional "match" block restricts the chaos specification effects to requests satisfying all of the listed
+predicates on request headers, URL query parameters and cookies. Each predicate specifies the value name and exactly
+one of the following conditions:
+
+	{
+	  "name": "<string: header, query parameter or cookie name>",
+	  "exact": "<string: value must be equal>",
+	  "prefix": "<string: value must start with prefix>",
+	  "regex": "<string: value must match regular expression>",
+	  "present": <bool: value must be present (true) or absent (false)>
+	}
+
 Upon successful request, a "204 No Content" status code is returned.
 
 	GET /
@@ -44,7 +308,7 @@ Get the chaos specification currently set for the corresponding target route:
 
 Delete the chaos specification set for the corresponding target route.
 
-Example Usage
+# Example Usage
 
 Set a 3 seconds delay with a 50% probability and a 504 error with a 100% probability for target route "POST /api/a":
 
@@ -70,7 +334,17 @@ Delete the currently set chaos specification for the target route "GET /api/b":
 Note: requests affected by a chaos specification feature a X-Chaos-Injected-* HTTP header
 describing the nature of the disruption. Example:
 
+	X-Chaos-Injected-Selector: POST /api/a
 	X-Chaos-Injected-Delay: 3s (probability: 0.5)
+	X-Chaos-Injected-Throttle: 1024 B/s, 102 B chunks (probability: 1.0)
+	X-Chaos-Injected-Corruption: truncate after 50% (probability: 0.1)
+	X-Chaos-Injected-Request-Mutation: remove headers Authorization (probability: 1.0)
 	X-Chaos-Injected-Error: 504 (probability: 1.0)
+	X-Chaos-Injected-Seed: 42 (decision: 17)
+
+The X-Chaos-Injected-Delay header reports the actual injected delay, which can vary for delay distributions. If
+the request is cancelled during the delay (e.g. the client disconnected), the delay stops early, the request processing
+is interrupted and the header reports the time elapsed before the cancellation. The number of requests cancelled during
+injection is reported by the GET configuration route.
 */
 package chaos
@@ -1,51 +1,252 @@
 package chaos
 
 import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"text/template"
 	"time"
 )
 
 type errorSpec struct {
-	statusCode  int
-	message     string
+	outcomes    []*errorOutcome
+	headers     map[string]string
+	contentType string
+	body        *template.Template
+	rawBody     *string
 	probability float64
+	ramp        *rampSpec
+}
+
+// errorOutcome represents one of the possible error responses of an error injection, sampled according to its weight
+// relative to the other outcomes.
+type errorOutcome struct {
+	statusCode int
+	message    string
+	headers    map[string]string
+	weight     float64
+}
+
+func (o *errorOutcome) UnmarshalJSON(data []byte) error {
+	outcome := struct {
+		StatusCode int               `json:"status_code"`
+		Message    string            `json:"message"`
+		Headers    map[string]string `json:"headers"`
+		Weight     *float64          `json:"weight"`
+	}{}
+
+	if err := json.Unmarshal(data, &outcome); err != nil {
+		return err
+	}
+
+	o.statusCode = outcome.StatusCode
+	o.message = outcome.Message
+	o.headers = outcome.Headers
+	o.weight = 1
+
+	if o.statusCode < 100 || o.statusCode > 600 {
+		return fmt.Errorf("error status code parameter value must be 100 < n < 600 ")
+	}
+
+	if outcome.Weight != nil {
+		if *outcome.Weight <= 0 {
+			return fmt.Errorf("error outcome weight parameter value must be greater than 0 ")
+		}
+
+		o.weight = *outcome.Weight
+	}
+
+	return nil
+}
+
+// errorBodyData represents the data available to error response body templates.
+type errorBodyData struct {
+	StatusCode int
+	Method     string
+	Path       string
+	RequestID  string
+	Captures   map[string]string
 }
 
 func (s *errorSpec) UnmarshalJSON(data []byte) error {
 	spec := struct {
-		StatusCode  int     `json:"status_code"`
-		Message     string  `json:"message"`
-		Probability float64 `json:"p"`
+		StatusCode  int               `json:"status_code"`
+		Message     string            `json:"message"`
+		Outcomes    []*errorOutcome   `json:"outcomes"`
+		Headers     map[string]string `json:"headers"`
+		ContentType string            `json:"content_type"`
+		Body        *string           `json:"body"`
+		RawBody     *string           `json:"raw_body"`
+		Probability float64           `json:"p"`
+		Ramp        *rampSpec         `json:"ramp"`
 	}{}
 
 	if err := json.Unmarshal(data, &spec); err != nil {
 		return err
 	}
 
-	s.statusCode = spec.StatusCode
-	s.message = spec.Message
+	s.outcomes = spec.Outcomes
+	s.headers = spec.Headers
+	s.contentType = spec.ContentType
+	s.rawBody = spec.RawBody
 	s.probability = spec.Probability
+	s.ramp = spec.Ramp
 
-	if s.statusCode < 100 || s.statusCode > 600 {
-		return fmt.Errorf("error status code parameter value must be 100 < n < 600 ")
+	if len(s.outcomes) > 0 {
+		if spec.StatusCode != 0 || spec.Message != "" {
+			return fmt.Errorf("error outcomes and status_code/message parameters are mutually exclusive")
+		}
+	} else {
+		if spec.StatusCode < 100 || spec.StatusCode > 600 {
+			return fmt.Errorf("error status code parameter value must be 100 < n < 600 ")
+		}
+
+		s.outcomes = []*errorOutcome{{statusCode: spec.StatusCode, message: spec.Message, weight: 1}}
+	}
+
+	if spec.Body != nil && spec.RawBody != nil {
+		return fmt.Errorf("error body and raw_body parameters are mutually exclusive")
+	}
+
+	if spec.Body != nil {
+		body, err := template.New("body").Parse(*spec.Body)
+		if err != nil {
+			return fmt.Errorf("invalid value for error body parameter: %s", err)
+		}
+
+		s.body = body
 	}
 
 	if s.probability < 0 || s.probability > 1 {
 		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
 	}
 
+	if s.ramp != nil && s.ramp.duration != nil {
+		return fmt.Errorf("error ramp duration_from parameter is not supported")
+	}
+
 	return nil
 }
 
-func (s *spec) injectError() (bool, int, string) {
-	if s.err != nil {
-		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-		if p := rnd.Float64(); p > 1-s.err.probability {
-			return true, s.err.statusCode, s.err.message
+// currentProbability returns the error probability at time now, taking the error ramp into account.
+func (s *errorSpec) currentProbability(now time.Time) float64 {
+	return s.ramp.rampProbability(s.probability, now)
+}
+
+func (s *errorSpec) String() string {
+	if len(s.outcomes) == 1 {
+		return fmt.Sprintf("%d", s.outcomes[0].statusCode)
+	}
+
+	var total float64
+	for _, o := range s.outcomes {
+		total += o.weight
+	}
+
+	desc := ""
+	for i, o := range s.outcomes {
+		if i > 0 {
+			desc += ", "
+		}
+		desc += fmt.Sprintf("%d: %.0f%%", o.statusCode, o.weight/total*100)
+	}
+
+	return desc
+}
+
+// outcome returns an error outcome randomly chosen according to the outcomes weights.
+func (s *errorSpec) outcome(rnd *rand.Rand) *errorOutcome {
+	if len(s.outcomes) == 1 {
+		return s.outcomes[0]
+	}
+
+	var total float64
+	for _, o := range s.outcomes {
+		total += o.weight
+	}
+
+	x := rnd.Float64() * total
+	for _, o := range s.outcomes {
+		if x < o.weight {
+			return o
 		}
+		x -= o.weight
+	}
+
+	return s.outcomes[len(s.outcomes)-1]
+}
+
+// write writes the error response of outcome o to rw for the HTTP request r, captures being the values of the route
+// path regular expression named capture groups. Unless a custom body is set, the response is a plain text error
+// message like returned by http.Error.
+func (s *errorSpec) write(rw http.ResponseWriter, r *http.Request, o *errorOutcome, captures map[string]string) {
+	for name, value := range s.headers {
+		rw.Header().Set(name, value)
+	}
+
+	for name, value := range o.headers {
+		rw.Header().Set(name, value)
+	}
+
+	if s.body == nil && s.rawBody == nil {
+		if s.contentType != "" {
+			rw.Header().Set("Content-Type", s.contentType)
+			rw.WriteHeader(o.statusCode)
+			fmt.Fprintln(rw, o.message)
+			return
+		}
+
+		http.Error(rw, o.message, o.statusCode)
+		return
+	}
+
+	var body bytes.Buffer
+	if s.rawBody != nil {
+		body.WriteString(*s.rawBody)
+	} else if err := s.body.Execute(&body, errorBodyData{
+		StatusCode: o.statusCode,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RequestID:  requestID(r),
+		Captures:   captures,
+	}); err != nil {
+		http.Error(rw, fmt.Sprintf("Invalid error body template: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := s.contentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(o.statusCode)
+	rw.Write(body.Bytes())
+}
+
+// requestID returns the ID of the HTTP request r as set in the X-Request-ID request header, or a random ID if it is
+// not set.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+
+	id := make([]byte, 8)
+	crand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// injectError returns the error outcome to inject for the HTTP request r drawn using the random number generator rnd,
+// or nil if no error must be injected.
+func (s *spec) injectError(r *http.Request, rnd *rand.Rand) *errorOutcome {
+	if s.err == nil || !s.sample(r, rnd, "error", s.err.currentProbability(time.Now())) {
+		return nil
 	}
 
-	return false, 0, ""
+	return s.err.outcome(rnd)
 }
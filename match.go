@@ -0,0 +1,188 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type matchSpec struct {
+	headers []*matchPredicate
+	query   []*matchPredicate
+	cookies []*matchPredicate
+}
+
+func (s *matchSpec) UnmarshalJSON(data []byte) error {
+	matchSpec := struct {
+		Headers []*matchPredicate `json:"headers"`
+		Query   []*matchPredicate `json:"query"`
+		Cookies []*matchPredicate `json:"cookies"`
+	}{}
+
+	if err := json.Unmarshal(data, &matchSpec); err != nil {
+		return err
+	}
+
+	s.headers = matchSpec.Headers
+	s.query = matchSpec.Query
+	s.cookies = matchSpec.Cookies
+
+	for _, predicates := range [][]*matchPredicate{s.headers, s.query, s.cookies} {
+		for _, p := range predicates {
+			if p == nil {
+				return fmt.Errorf("match predicate must not be null")
+			}
+		}
+	}
+
+	return nil
+}
+
+// matches returns true if the HTTP request r satisfies all the match predicates.
+func (s *matchSpec) matches(r *http.Request) bool {
+	for _, p := range s.headers {
+		if !p.matches(r.Header.Values(p.name)) {
+			return false
+		}
+	}
+
+	if len(s.query) > 0 {
+		query := r.URL.Query()
+		for _, p := range s.query {
+			if !p.matches(query[p.name]) {
+				return false
+			}
+		}
+	}
+
+	for _, p := range s.cookies {
+		var values []string
+		if cookie, err := r.Cookie(p.name); err == nil {
+			values = []string{cookie.Value}
+		}
+
+		if !p.matches(values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// describe returns the description of the match predicates.
+func (s *matchSpec) describe() []string {
+	var lines []string
+
+	for _, p := range s.headers {
+		lines = append(lines, "header "+p.String())
+	}
+
+	for _, p := range s.query {
+		lines = append(lines, "query "+p.String())
+	}
+
+	for _, p := range s.cookies {
+		lines = append(lines, "cookie "+p.String())
+	}
+
+	return lines
+}
+
+// matchPredicate represents a predicate on a named request value (header, query parameter or cookie): exactly one
+// of exact value, value prefix, value regular expression or presence must be set.
+type matchPredicate struct {
+	name    string
+	exact   *string
+	prefix  *string
+	regex   *regexp.Regexp
+	present *bool
+}
+
+func (p *matchPredicate) UnmarshalJSON(data []byte) error {
+	predicate := struct {
+		Name    string  `json:"name"`
+		Exact   *string `json:"exact"`
+		Prefix  *string `json:"prefix"`
+		Regex   *string `json:"regex"`
+		Present *bool   `json:"present"`
+	}{}
+
+	if err := json.Unmarshal(data, &predicate); err != nil {
+		return err
+	}
+
+	p.name = predicate.Name
+	p.exact = predicate.Exact
+	p.prefix = predicate.Prefix
+	p.present = predicate.Present
+
+	if p.name == "" {
+		return fmt.Errorf("match predicate name parameter value must not be empty")
+	}
+
+	n := 0
+	for _, set := range []bool{
+		predicate.Exact != nil,
+		predicate.Prefix != nil,
+		predicate.Regex != nil,
+		predicate.Present != nil,
+	} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("match predicate must specify exactly one of exact, prefix, regex or present parameters")
+	}
+
+	if predicate.Regex != nil {
+		re, err := regexp.Compile(*predicate.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid value for match predicate regex parameter: %s", err)
+		}
+
+		p.regex = re
+	}
+
+	return nil
+}
+
+// matches returns true if the predicate is satisfied by the request values: for value predicates, at least one
+// value must satisfy the predicate.
+func (p *matchPredicate) matches(values []string) bool {
+	if p.present != nil {
+		return (len(values) > 0) == *p.present
+	}
+
+	for _, v := range values {
+		switch {
+		case p.exact != nil && v == *p.exact,
+			p.prefix != nil && strings.HasPrefix(v, *p.prefix),
+			p.regex != nil && p.regex.MatchString(v):
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *matchPredicate) String() string {
+	switch {
+	case p.exact != nil:
+		return fmt.Sprintf("%s = %q", p.name, *p.exact)
+
+	case p.prefix != nil:
+		return fmt.Sprintf("%s ^= %q", p.name, *p.prefix)
+
+	case p.regex != nil:
+		return fmt.Sprintf("%s ~= %q", p.name, p.regex)
+
+	case *p.present:
+		return fmt.Sprintf("%s present", p.name)
+
+	default:
+		return fmt.Sprintf("%s absent", p.name)
+	}
+}
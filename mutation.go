@@ -0,0 +1,272 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type requestMutationSpec struct {
+	addHeaders    map[string]string
+	setHeaders    map[string]string
+	removeHeaders []string
+	setQuery      map[string]string
+	removeQuery   []string
+	body          *string
+	probability   float64
+}
+
+func (s *requestMutationSpec) UnmarshalJSON(data []byte) error {
+	mutationSpec := struct {
+		AddHeaders    map[string]string `json:"add_headers"`
+		SetHeaders    map[string]string `json:"set_headers"`
+		RemoveHeaders []string          `json:"remove_headers"`
+		SetQuery      map[string]string `json:"set_query"`
+		RemoveQuery   []string          `json:"remove_query"`
+		Body          *string           `json:"body"`
+		Probability   float64           `json:"p"`
+	}{}
+
+	if err := json.Unmarshal(data, &mutationSpec); err != nil {
+		return err
+	}
+
+	s.addHeaders = mutationSpec.AddHeaders
+	s.setHeaders = mutationSpec.SetHeaders
+	s.removeHeaders = mutationSpec.RemoveHeaders
+	s.setQuery = mutationSpec.SetQuery
+	s.removeQuery = mutationSpec.RemoveQuery
+	s.body = mutationSpec.Body
+	s.probability = mutationSpec.Probability
+
+	if len(s.addHeaders) == 0 && len(s.setHeaders) == 0 && len(s.removeHeaders) == 0 &&
+		len(s.setQuery) == 0 && len(s.removeQuery) == 0 && s.body == nil {
+		return fmt.Errorf("request mutation requires at least one of add_headers, set_headers, remove_headers, " +
+			"set_query, remove_query or body parameters")
+	}
+
+	if s.probability < 0 || s.probability > 1 {
+		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
+	}
+
+	return nil
+}
+
+func (s *requestMutationSpec) String() string {
+	var desc []string
+
+	if len(s.addHeaders) > 0 {
+		desc = append(desc, "add headers "+strings.Join(keys(s.addHeaders), ", "))
+	}
+
+	if len(s.setHeaders) > 0 {
+		desc = append(desc, "set headers "+strings.Join(keys(s.setHeaders), ", "))
+	}
+
+	if len(s.removeHeaders) > 0 {
+		desc = append(desc, "remove headers "+strings.Join(s.removeHeaders, ", "))
+	}
+
+	if len(s.setQuery) > 0 {
+		desc = append(desc, "set query "+strings.Join(keys(s.setQuery), ", "))
+	}
+
+	if len(s.removeQuery) > 0 {
+		desc = append(desc, "remove query "+strings.Join(s.removeQuery, ", "))
+	}
+
+	if s.body != nil {
+		desc = append(desc, fmt.Sprintf("replace body (%d B)", len(*s.body)))
+	}
+
+	return strings.Join(desc, "; ")
+}
+
+func (s *spec) injectRequestMutation(r *http.Request, rnd *rand.Rand) bool {
+	return s.requestMutation != nil && s.sample(r, rnd, "request_mutation", s.requestMutation.probability)
+}
+
+// mutate returns a copy of the HTTP request r with the mutations applied. Setting the "Host" header rewrites the
+// request host.
+func (s *requestMutationSpec) mutate(r *http.Request) *http.Request {
+	r = r.Clone(r.Context())
+
+	for name, value := range s.addHeaders {
+		r.Header.Add(name, value)
+	}
+
+	for name, value := range s.setHeaders {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			r.Host = value
+			continue
+		}
+		r.Header.Set(name, value)
+	}
+
+	for _, name := range s.removeHeaders {
+		r.Header.Del(name)
+	}
+
+	if len(s.setQuery) > 0 || len(s.removeQuery) > 0 {
+		query := r.URL.Query()
+
+		for name, value := range s.setQuery {
+			query.Set(name, value)
+		}
+
+		for _, name := range s.removeQuery {
+			query.Del(name)
+		}
+
+		r.URL.RawQuery = query.Encode()
+	}
+
+	if s.body != nil {
+		r.Body = ioutil.NopCloser(strings.NewReader(*s.body))
+		r.ContentLength = int64(len(*s.body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(*s.body)))
+		r.Header.Del("Transfer-Encoding")
+		r.TransferEncoding = nil
+	}
+
+	return r
+}
+
+type responseMutationSpec struct {
+	setHeaders    map[string]string
+	removeHeaders []string
+	statusCode    int
+	probability   float64
+}
+
+func (s *responseMutationSpec) UnmarshalJSON(data []byte) error {
+	mutationSpec := struct {
+		SetHeaders    map[string]string `json:"set_headers"`
+		RemoveHeaders []string          `json:"remove_headers"`
+		StatusCode    int               `json:"status_code"`
+		Probability   float64           `json:"p"`
+	}{}
+
+	if err := json.Unmarshal(data, &mutationSpec); err != nil {
+		return err
+	}
+
+	s.setHeaders = mutationSpec.SetHeaders
+	s.removeHeaders = mutationSpec.RemoveHeaders
+	s.statusCode = mutationSpec.StatusCode
+	s.probability = mutationSpec.Probability
+
+	if len(s.setHeaders) == 0 && len(s.removeHeaders) == 0 && s.statusCode == 0 {
+		return fmt.Errorf("response mutation requires at least one of set_headers, remove_headers or " +
+			"status_code parameters")
+	}
+
+	if s.statusCode != 0 && (s.statusCode < 100 || s.statusCode > 600) {
+		return fmt.Errorf("response mutation status code parameter value must be 100 < n < 600 ")
+	}
+
+	if s.probability < 0 || s.probability > 1 {
+		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
+	}
+
+	return nil
+}
+
+func (s *responseMutationSpec) String() string {
+	var desc []string
+
+	if len(s.setHeaders) > 0 {
+		desc = append(desc, "set headers "+strings.Join(keys(s.setHeaders), ", "))
+	}
+
+	if len(s.removeHeaders) > 0 {
+		desc = append(desc, "remove headers "+strings.Join(s.removeHeaders, ", "))
+	}
+
+	if s.statusCode != 0 {
+		desc = append(desc, fmt.Sprintf("successful status code %d", s.statusCode))
+	}
+
+	return strings.Join(desc, "; ")
+}
+
+func (s *spec) injectResponseMutation(r *http.Request, rnd *rand.Rand) bool {
+	return s.responseMutation != nil && s.sample(r, rnd, "response_mutation", s.responseMutation.probability)
+}
+
+// mutatedResponseWriter is a http.ResponseWriter applying the response mutations to the response head written by the
+// downstream handler. The status code is only replaced for successful (2xx) responses.
+type mutatedResponseWriter struct {
+	http.ResponseWriter
+
+	spec        *spec
+	wroteHeader bool
+}
+
+func newMutatedResponseWriter(rw http.ResponseWriter, spec *spec) *mutatedResponseWriter {
+	return &mutatedResponseWriter{
+		ResponseWriter: rw,
+		spec:           spec,
+	}
+}
+
+func (w *mutatedResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	for name, value := range w.spec.responseMutation.setHeaders {
+		w.Header().Set(name, value)
+	}
+
+	for _, name := range w.spec.responseMutation.removeHeaders {
+		w.Header().Del(name)
+	}
+
+	if w.spec.responseMutation.statusCode != 0 && statusCode >= 200 && statusCode < 300 {
+		statusCode = w.spec.responseMutation.statusCode
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *mutatedResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *mutatedResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	flush(w.ResponseWriter)
+}
+
+func (w *mutatedResponseWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	finishResponse(w.ResponseWriter)
+}
+
+// keys returns the sorted keys of map m.
+func keys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
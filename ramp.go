@@ -0,0 +1,113 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// rampSpec represents the progressive ramp of an injection parameters from their start values to their configured
+// values over a duration, either linearly or stepwise.
+type rampSpec struct {
+	probability *float64
+	duration    *time.Duration
+	over        time.Duration
+	steps       int
+	start       time.Time
+}
+
+func (s *rampSpec) UnmarshalJSON(data []byte) error {
+	rampSpec := struct {
+		Probability *float64 `json:"p_from"`
+		Duration    *int     `json:"duration_from"`
+		Over        string   `json:"over"`
+		Steps       int      `json:"steps"`
+	}{}
+
+	if err := json.Unmarshal(data, &rampSpec); err != nil {
+		return err
+	}
+
+	s.probability = rampSpec.Probability
+	s.steps = rampSpec.Steps
+	s.start = time.Now()
+
+	if s.probability == nil && rampSpec.Duration == nil {
+		return fmt.Errorf("ramp requires at least one of p_from or duration_from parameters")
+	}
+
+	if s.probability != nil && (*s.probability < 0 || *s.probability > 1) {
+		return fmt.Errorf("ramp p_from parameter value must be 0 < p < 1 ")
+	}
+
+	if rampSpec.Duration != nil {
+		if *rampSpec.Duration < 0 {
+			return fmt.Errorf("ramp duration_from parameter value must be positive")
+		}
+
+		duration := time.Duration(*rampSpec.Duration) * time.Millisecond
+		s.duration = &duration
+	}
+
+	over, err := time.ParseDuration(rampSpec.Over)
+	if err != nil {
+		return fmt.Errorf("invalid value for ramp over parameter: %s", err)
+	}
+	if over <= 0 {
+		return fmt.Errorf("ramp over parameter value must be greater than 0 ")
+	}
+	s.over = over
+
+	if s.steps < 0 {
+		return fmt.Errorf("ramp steps parameter value must be positive")
+	}
+
+	return nil
+}
+
+func (s *rampSpec) String() string {
+	if s.steps > 0 {
+		return fmt.Sprintf("over %s in %d steps", s.over, s.steps)
+	}
+
+	return fmt.Sprintf("over %s linearly", s.over)
+}
+
+// progress returns the ramp progress at time now, between 0 (ramp start) and 1 (ramp end).
+func (s *rampSpec) progress(now time.Time) float64 {
+	elapsed := now.Sub(s.start)
+
+	switch {
+	case elapsed <= 0:
+		return 0
+
+	case elapsed >= s.over:
+		return 1
+	}
+
+	progress := float64(elapsed) / float64(s.over)
+	if s.steps > 0 {
+		progress = math.Floor(progress*float64(s.steps)) / float64(s.steps)
+	}
+
+	return progress
+}
+
+// rampProbability returns the probability ramped towards p at time now.
+func (s *rampSpec) rampProbability(p float64, now time.Time) float64 {
+	if s == nil || s.probability == nil {
+		return p
+	}
+
+	return *s.probability + (p-*s.probability)*s.progress(now)
+}
+
+// rampDuration returns the duration ramped towards d at time now, rounded to the millisecond.
+func (s *rampSpec) rampDuration(d time.Duration, now time.Time) time.Duration {
+	if s == nil || s.duration == nil {
+		return d
+	}
+
+	return (*s.duration + time.Duration(float64(d-*s.duration)*s.progress(now))).Round(time.Millisecond)
+}
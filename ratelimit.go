@@ -0,0 +1,183 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Maximum number of per-key rate limit buckets tracked before full buckets are evicted.
+const maxRateLimitBuckets = 10000
+
+type rateLimitSpec struct {
+	rate  float64
+	burst int
+	key   *samplingSpec
+
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket represents the state of a rate limit token bucket, the number of tokens being refilled lazily.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (s *rateLimitSpec) UnmarshalJSON(data []byte) error {
+	rateLimitSpec := struct {
+		Rate  float64 `json:"rate"`
+		Burst int     `json:"burst"`
+		Key   string  `json:"key"`
+		Name  string  `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(data, &rateLimitSpec); err != nil {
+		return err
+	}
+
+	s.rate = rateLimitSpec.Rate
+	s.burst = rateLimitSpec.Burst
+	s.buckets = make(map[string]*tokenBucket)
+
+	if s.rate <= 0 {
+		return fmt.Errorf("rate limit rate parameter value must be greater than 0 ")
+	}
+
+	if s.burst < 0 {
+		return fmt.Errorf("rate limit burst parameter value must be positive")
+	}
+
+	if s.burst == 0 {
+		s.burst = int(math.Max(math.Ceil(s.rate), 1))
+	}
+
+	if rateLimitSpec.Key != "" {
+		s.key = &samplingSpec{key: rateLimitSpec.Key, name: rateLimitSpec.Name}
+
+		if err := s.key.validate(); err != nil {
+			return fmt.Errorf("invalid value for rate limit key parameter: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *rateLimitSpec) String() string {
+	desc := fmt.Sprintf("%g req/s, burst %d", s.rate, s.burst)
+
+	if s.key != nil {
+		if s.key.key == "client_ip" {
+			desc += ", per client IP"
+		} else {
+			desc += fmt.Sprintf(", per %s %s", s.key.key, s.key.name)
+		}
+	}
+
+	return desc
+}
+
+// take takes a token from the bucket of key at time now. It returns false if the bucket is exhausted, along with the
+// number of tokens remaining in the bucket and the time until a token is available.
+func (s *rateLimitSpec) take(key string, now time.Time) (bool, float64, time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= maxRateLimitBuckets {
+			s.evict(now)
+		}
+
+		b = &tokenBucket{tokens: float64(s.burst), last: now}
+		s.buckets[key] = b
+	}
+
+	s.refill(b, now)
+
+	if b.tokens < 1 {
+		return false, b.tokens, time.Duration((1 - b.tokens) / s.rate * float64(time.Second))
+	}
+	b.tokens--
+
+	return true, b.tokens, 0
+}
+
+func (s *rateLimitSpec) refill(b *tokenBucket, now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(s.burst), b.tokens+now.Sub(b.last).Seconds()*s.rate)
+		b.last = now
+	}
+}
+
+// evict removes the buckets that are full at time now, since they are equivalent to new buckets.
+func (s *rateLimitSpec) evict(now time.Time) {
+	for key, b := range s.buckets {
+		if s.refill(b, now); b.tokens >= float64(s.burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// state returns the number of tracked buckets, the number of exhausted buckets and the number of tokens available in
+// the least filled bucket at time now.
+func (s *rateLimitSpec) state(now time.Time) (int, int, float64) {
+	s.Lock()
+	defer s.Unlock()
+
+	var (
+		exhausted int
+		tokens    = float64(s.burst)
+	)
+
+	for _, b := range s.buckets {
+		s.refill(b, now)
+
+		if b.tokens < 1 {
+			exhausted++
+		}
+
+		tokens = math.Min(tokens, b.tokens)
+	}
+
+	return len(s.buckets), exhausted, tokens
+}
+
+// injectRateLimit takes a token from the spec rate limit bucket of the HTTP request r and reports the bucket state in
+// the X-RateLimit-* response headers. If the bucket is exhausted, it writes a "429 Too Many Requests" error to rw
+// and returns true.
+func (s *spec) injectRateLimit(rw http.ResponseWriter, r *http.Request) bool {
+	if s.rateLimit == nil {
+		return false
+	}
+
+	var key string
+	if s.rateLimit.key != nil {
+		key, _ = s.rateLimit.key.value(r, s.xffDepth)
+	}
+
+	ok, remaining, wait := s.rateLimit.take(key, time.Now())
+
+	rw.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit.burst))
+	rw.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	rw.Header().Set("X-RateLimit-Reset",
+		strconv.Itoa(int(math.Ceil((float64(s.rateLimit.burst)-remaining)/s.rateLimit.rate))))
+
+	if ok {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+
+	rw.Header().Set("X-Chaos-Injected-Selector", s.target())
+	rw.Header().Add("X-Chaos-Injected-Rate-Limit", fmt.Sprintf("%s (retry after %s)", s.rateLimit,
+		wait.Round(time.Millisecond)))
+	rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(rw, "Too Many Requests", http.StatusTooManyRequests)
+
+	return true
+}
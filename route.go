@@ -0,0 +1,215 @@
+package chaos
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// pathPattern represents a target route URL path selector. In addition to literal paths, a pattern can contain
+// glob-style wildcards ("*" matching any character except "/"), gorilla/mux-style variables ("{id}", optionally
+// constrained by a regular expression such as "{id:[0-9]+}") and a trailing "**" segment matching any number of
+// remaining path segments (e.g. "/api/**").
+type pathPattern struct {
+	raw      string
+	segments []pathSegment
+	prefix   bool
+}
+
+type pathSegment struct {
+	literal string
+	re      *regexp.Regexp
+}
+
+func parsePathPattern(raw string) (*pathPattern, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("path pattern must start with \"/\"")
+	}
+
+	p := pathPattern{raw: raw}
+
+	parts := strings.Split(strings.TrimPrefix(raw, "/"), "/")
+	for i, part := range parts {
+		if part == "**" {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("\"**\" wildcard is only allowed as last path segment")
+			}
+			p.prefix = true
+			break
+		}
+
+		segment, err := parsePathSegment(part)
+		if err != nil {
+			return nil, err
+		}
+		p.segments = append(p.segments, segment)
+	}
+
+	return &p, nil
+}
+
+func parsePathSegment(s string) (pathSegment, error) {
+	if !strings.ContainsAny(s, "*{}") {
+		return pathSegment{literal: s}, nil
+	}
+
+	var expr strings.Builder
+
+	expr.WriteString("^")
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*':
+			expr.WriteString("[^/]*")
+
+		case '{':
+			end, depth := -1, 0
+			for j := i; j < len(s) && end < 0; j++ {
+				switch s[j] {
+				case '{':
+					depth++
+				case '}':
+					if depth--; depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end < 0 {
+				return pathSegment{}, fmt.Errorf("unbalanced braces in path segment %q", s)
+			}
+
+			variable := s[i+1 : end]
+			if idx := strings.Index(variable, ":"); idx >= 0 {
+				if _, err := regexp.Compile(variable[idx+1:]); err != nil {
+					return pathSegment{}, fmt.Errorf("invalid variable pattern in path segment %q: %s", s, err)
+				}
+				expr.WriteString("(?:" + variable[idx+1:] + ")")
+			} else {
+				expr.WriteString("[^/]+")
+			}
+			i = end
+
+		case '}':
+			return pathSegment{}, fmt.Errorf("unbalanced braces in path segment %q", s)
+
+		default:
+			expr.WriteString(regexp.QuoteMeta(s[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return pathSegment{}, fmt.Errorf("invalid path segment %q: %s", s, err)
+	}
+
+	return pathSegment{re: re}, nil
+}
+
+// match returns true if the URL path p matches the pattern. The path is walked segment by segment without
+// allocating, since it is matched against every spec for each request.
+func (p *pathPattern) match(path string) bool {
+	rest, more := strings.TrimPrefix(path, "/"), true
+
+	for _, segment := range p.segments {
+		if !more {
+			return false
+		}
+
+		part := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			part, rest = rest[:i], rest[i+1:]
+		} else {
+			more = false
+		}
+
+		if segment.re != nil {
+			if !segment.re.MatchString(part) {
+				return false
+			}
+		} else if part != segment.literal {
+			return false
+		}
+	}
+
+	// Remaining path segments are only allowed by a trailing "**" segment.
+	return p.prefix || !more
+}
+
+// literals returns the number of literal segments in the pattern.
+func (p *pathPattern) literals() int {
+	n := 0
+	for _, segment := range p.segments {
+		if segment.re == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// compare returns a positive value if pattern p takes precedence over pattern o when both match a given URL path,
+// a negative value if o takes precedence over p or 0 if both are equally specific: a pattern with more literal
+// segments wins, then a pattern without trailing "**" wins over a prefix pattern, then the pattern with the most
+// segments wins.
+func (p *pathPattern) compare(o *pathPattern) int {
+	if p.literals() != o.literals() {
+		return p.literals() - o.literals()
+	}
+
+	if p.prefix != o.prefix {
+		if p.prefix {
+			return -1
+		}
+		return 1
+	}
+
+	return len(p.segments) - len(o.segments)
+}
+
+// parseMethods parses a target route HTTP method selector, either a single method (e.g. "GET"), a comma-separated
+// list of methods (e.g. "GET,POST") or "*" matching any method. It returns the normalized list of methods (upper
+// case, sorted and deduplicated), which is empty for the wildcard selector.
+func parseMethods(s string) ([]string, error) {
+	var (
+		methods []string
+		seen    = make(map[string]bool)
+	)
+
+	if strings.TrimSpace(s) == "*" {
+		return nil, nil
+	}
+
+	for _, m := range strings.Split(s, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+
+		switch {
+		case m == "":
+			return nil, fmt.Errorf("empty method in methods list")
+
+		case m == "*":
+			return nil, fmt.Errorf("\"*\" wildcard cannot be combined with other methods")
+
+		case strings.ContainsAny(m, " /"):
+			return nil, fmt.Errorf("invalid method %q", m)
+		}
+
+		if !seen[m] {
+			seen[m] = true
+			methods = append(methods, m)
+		}
+	}
+
+	sort.Strings(methods)
+
+	return methods, nil
+}
+
+// formatMethods returns the string representation of a normalized list of methods as returned by parseMethods.
+func formatMethods(methods []string) string {
+	if len(methods) == 0 {
+		return "*"
+	}
+
+	return strings.Join(methods, ",")
+}
@@ -0,0 +1,106 @@
+package chaos
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+)
+
+type samplingSpec struct {
+	key  string
+	name string
+}
+
+func (s *samplingSpec) UnmarshalJSON(data []byte) error {
+	samplingSpec := struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(data, &samplingSpec); err != nil {
+		return err
+	}
+
+	s.key = samplingSpec.Key
+	s.name = samplingSpec.Name
+
+	return s.validate()
+}
+
+func (s *samplingSpec) validate() error {
+	switch s.key {
+	case "header", "cookie", "query":
+		if s.name == "" {
+			return fmt.Errorf("sampling name parameter value must not be empty for %s key", s.key)
+		}
+
+	case "client_ip":
+
+	default:
+		return fmt.Errorf("sampling key parameter value must be one of header, cookie, query or client_ip")
+	}
+
+	return nil
+}
+
+// value returns the sampling key value of the HTTP request r, or false if the request doesn't feature it.
+func (s *samplingSpec) value(r *http.Request, xffDepth int) (string, bool) {
+	var v string
+
+	switch s.key {
+	case "header":
+		v = r.Header.Get(s.name)
+
+	case "cookie":
+		if cookie, err := r.Cookie(s.name); err == nil {
+			v = cookie.Value
+		}
+
+	case "query":
+		v = r.URL.Query().Get(s.name)
+
+	case "client_ip":
+		if ip := clientIP(r, xffDepth); ip != nil {
+			v = ip.String()
+		}
+	}
+
+	return v, v != ""
+}
+
+func (s *samplingSpec) String() string {
+	if s.key == "client_ip" {
+		return "sticky on client IP"
+	}
+
+	return fmt.Sprintf("sticky on %s %s", s.key, s.name)
+}
+
+// sample returns true if the effect named effect having a probability p must be injected for the HTTP request r. If
+// the spec features sticky sampling, the decision is based on a hash of the request sampling key value so that the
+// same value is consistently in or out of the effect; otherwise (or if the request doesn't feature a sampling key
+// value) the decision is drawn from the random number generator rnd. The hash is salted with the spec seed, the spec
+// route key and the effect name, so that distinct effects and specs select independent sets of values.
+func (s *spec) sample(r *http.Request, rnd *rand.Rand, effect string, p float64) bool {
+	if s.sampling != nil {
+		if v, ok := s.sampling.value(r, s.xffDepth); ok {
+			var seed [8]byte
+			binary.LittleEndian.PutUint64(seed[:], uint64(s.seed))
+
+			h := fnv.New64a()
+			h.Write(seed[:])
+			h.Write([]byte(s.key()))
+			h.Write([]byte{0})
+			h.Write([]byte(effect))
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+
+			return float64(mix64(h.Sum64())>>11)/(1<<53) < p
+		}
+	}
+
+	return rnd.Float64() > 1-p
+}
@@ -0,0 +1,220 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleSpec represents a recurring activity window, starting at the times matching a cron expression and lasting
+// for a fixed duration.
+type scheduleSpec struct {
+	cron     string
+	minutes  cronField
+	hours    cronField
+	doms     cronField
+	months   cronField
+	dows     cronField
+	duration time.Duration
+	location *time.Location
+}
+
+// cronField represents the set of values allowed for a cron expression field, along with whether the field is
+// restricted (i.e. not "*").
+type cronField struct {
+	values     uint64
+	restricted bool
+}
+
+func (f cronField) has(v int) bool {
+	return f.values&(1<<uint(v)) != 0
+}
+
+func (s *scheduleSpec) UnmarshalJSON(data []byte) error {
+	scheduleSpec := struct {
+		Cron     string `json:"cron"`
+		Duration string `json:"duration"`
+		Timezone string `json:"timezone"`
+	}{}
+
+	if err := json.Unmarshal(data, &scheduleSpec); err != nil {
+		return err
+	}
+
+	if err := s.parseCron(scheduleSpec.Cron); err != nil {
+		return fmt.Errorf("invalid value for schedule cron parameter: %s", err)
+	}
+
+	duration, err := time.ParseDuration(scheduleSpec.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid value for schedule duration parameter: %s", err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("schedule duration parameter value must be greater than 0 ")
+	}
+	s.duration = duration
+
+	s.location = time.UTC
+	if scheduleSpec.Timezone != "" {
+		if s.location, err = time.LoadLocation(scheduleSpec.Timezone); err != nil {
+			return fmt.Errorf("invalid value for schedule timezone parameter: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// parseCron parses a standard 5 fields cron expression (minute, hour, day of month, month and day of week).
+func (s *scheduleSpec) parseCron(cron string) error {
+	fields := strings.Fields(cron)
+	if len(fields) != 5 {
+		return fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week)")
+	}
+
+	for i, f := range []struct {
+		field    *cronField
+		min, max int
+	}{
+		{&s.minutes, 0, 59},
+		{&s.hours, 0, 23},
+		{&s.doms, 1, 31},
+		{&s.months, 1, 12},
+		{&s.dows, 0, 7},
+	} {
+		field, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return fmt.Errorf("field %q: %s", fields[i], err)
+		}
+		*f.field = field
+	}
+
+	// Both 0 and 7 stand for Sunday.
+	if s.dows.has(7) {
+		s.dows.values |= 1
+	}
+
+	s.cron = strings.Join(fields, " ")
+
+	return nil
+}
+
+// parseCronField parses a cron expression field made of comma-separated "*", "N" or "N-M" ranges, optionally followed
+// by a "/STEP" step, with values in the [min, max] range.
+func parseCronField(s string, min, max int) (cronField, error) {
+	var field cronField
+
+	for _, part := range strings.Split(s, ",") {
+		var (
+			rng  = part
+			step = 1
+			err  error
+		)
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return field, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			field.restricted = true
+
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return field, fmt.Errorf("invalid value %q", bounds[0])
+			}
+
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return field, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				hi = max
+			}
+
+			if lo < min || hi > max || lo > hi {
+				return field, fmt.Errorf("value out of range [%d-%d]", min, max)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			field.values |= 1 << uint(v)
+		}
+	}
+
+	return field, nil
+}
+
+func (s *scheduleSpec) String() string {
+	return fmt.Sprintf("%q for %s (%s)", s.cron, s.duration, s.location)
+}
+
+// matchesDay returns true if the day of t matches the cron expression. Like in standard cron, if both the day of
+// month and the day of week fields are restricted, either one matching is enough.
+func (s *scheduleSpec) matchesDay(t time.Time) bool {
+	if !s.months.has(int(t.Month())) {
+		return false
+	}
+
+	if s.doms.restricted && s.dows.restricted {
+		return s.doms.has(t.Day()) || s.dows.has(int(t.Weekday()))
+	}
+
+	return s.doms.has(t.Day()) && s.dows.has(int(t.Weekday()))
+}
+
+// active returns true if the time now falls within a schedule window, i.e. if a time matching the cron expression
+// occurred less than the schedule duration before now.
+func (s *scheduleSpec) active(now time.Time) bool {
+	var (
+		limit = now.Add(-s.duration)
+		t     = now.In(s.location).Truncate(time.Minute)
+	)
+
+	// Walk back in time from now, skipping whole days and hours not matching the cron expression.
+	for t.After(limit) {
+		switch {
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location).Add(-time.Minute)
+
+		case !s.hours.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location).Add(-time.Minute)
+
+		case !s.minutes.has(t.Minute()):
+			t = t.Add(-time.Minute)
+
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// active returns true if the spec effects must be enforced at time now.
+func (s *spec) active(now time.Time) bool {
+	if !s.startAt.IsZero() && now.Before(s.startAt) {
+		return false
+	}
+
+	if !s.until.IsZero() && !now.Before(s.until) {
+		return false
+	}
+
+	if s.schedule != nil && !s.schedule.active(now) {
+		return false
+	}
+
+	if s.cycle != nil {
+		if on, _ := s.cycle.phase(now); !on {
+			return false
+		}
+	}
+
+	return true
+}
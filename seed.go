@@ -0,0 +1,88 @@
+package chaos
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// decisionSource is a rand.Source64 implementing the SplitMix64 generator, cheap to seed so that every injection
+// decision can be derived from its own source.
+type decisionSource struct {
+	state uint64
+}
+
+// Pool of random number generators backed by a decisionSource, reseeded for every decision.
+var decisionRands = sync.Pool{
+	New: func() interface{} { return rand.New(&decisionSource{}) },
+}
+
+// newDecisionSource returns a source generating the random values of the decision n of the decision stream seed.
+func newDecisionSource(seed int64, n uint64) *decisionSource {
+	return &decisionSource{state: decisionState(seed, n)}
+}
+
+// decisionState returns the initial source state of the decision n of the decision stream seed, deterministically
+// derived from seed and n so that any decision can be replayed independently of the others.
+func decisionState(seed int64, n uint64) uint64 {
+	return mix64(uint64(seed) ^ mix64(n+1))
+}
+
+func (s *decisionSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *decisionSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+
+	return mix64(s.state)
+}
+
+func (s *decisionSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// mix64 is the SplitMix64 finalizer (see http://xoshiro.di.unimi.it/splitmix64.c).
+func mix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+
+	return x ^ (x >> 31)
+}
+
+// deriveSeed returns the seed of the decision stream of the spec identified by key, derived from the controller seed
+// so that the specs set under a same controller seed draw independent decisions.
+func deriveSeed(seed int64, key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return int64(mix64(uint64(seed) ^ h.Sum64()))
+}
+
+// decide returns the index of the next decision of the spec decision stream, seeding accordingly the random number
+// generator rnd (backed by a decisionSource) all the injection decisions regarding a single request must be drawn
+// from.
+func (s *spec) decide(rnd *rand.Rand) uint64 {
+	n := atomic.AddUint64(&s.decisions, 1) - 1
+	rnd.Seed(int64(decisionState(s.seed, n)))
+
+	return n
+}
+
+// setSeed sets the seed of the spec decision stream, from which the spec cycle jitter is also derived.
+func (s *spec) setSeed(seed int64) {
+	s.seed = seed
+
+	if s.cycle != nil {
+		s.cycle.seed = seed
+	}
+}
+
+// reportDecision reports the spec decision stream seed and the decision index n in the response written to rw,
+// allowing to replay the injection decisions.
+func (s *spec) reportDecision(rw http.ResponseWriter, n uint64) {
+	rw.Header().Set("X-Chaos-Injected-Seed", fmt.Sprintf("%d (decision: %d)", s.seed, n))
+}
@@ -0,0 +1,227 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported sequence step types.
+const (
+	stepError = "error"
+	stepDelay = "delay"
+	stepPass  = "pass"
+	stepAbort = "abort"
+)
+
+// Maximum number of per-key sequence positions tracked before they are all reset.
+const maxSequenceKeys = 10000
+
+type sequenceSpec struct {
+	steps []*sequenceStep
+	loop  bool
+	key   *samplingSpec
+
+	sync.Mutex
+	positions map[string]int
+}
+
+// sequenceStep represents the outcome of a sequence step, consumed by a single request.
+type sequenceStep struct {
+	kind  string
+	err   *errorSpec
+	delay time.Duration
+	abort *abortSpec
+}
+
+func (s *sequenceStep) UnmarshalJSON(data []byte) error {
+	step := struct {
+		Type       string `json:"type"`
+		StatusCode int    `json:"status_code"`
+		Message    string `json:"message"`
+		Duration   int    `json:"duration"`
+		Mode       string `json:"mode"`
+		Bytes      int    `json:"bytes"`
+	}{}
+
+	if err := json.Unmarshal(data, &step); err != nil {
+		return err
+	}
+
+	s.kind = step.Type
+
+	switch s.kind {
+	case stepError:
+		if step.StatusCode < 100 || step.StatusCode > 600 {
+			return fmt.Errorf("error status code parameter value must be 100 < n < 600 ")
+		}
+
+		s.err = &errorSpec{
+			outcomes:    []*errorOutcome{{statusCode: step.StatusCode, message: step.Message, weight: 1}},
+			probability: 1,
+		}
+
+	case stepDelay:
+		if step.Duration <= 0 {
+			return fmt.Errorf("delay duration parameter value must be greater than 0 ")
+		}
+
+		s.delay = time.Duration(step.Duration) * time.Millisecond
+
+	case stepPass:
+
+	case stepAbort:
+		s.abort = &abortSpec{mode: step.Mode, bytes: step.Bytes, probability: 1}
+
+		switch s.abort.mode {
+		case "":
+			s.abort.mode = abortClose
+
+		case abortClose, abortReset, abortPartial:
+
+		default:
+			return fmt.Errorf("abort mode parameter value must be one of close, reset or partial")
+		}
+
+		if s.abort.bytes < 0 {
+			return fmt.Errorf("abort bytes parameter value must be positive")
+		}
+
+	default:
+		return fmt.Errorf("sequence step type parameter value must be one of error, delay, pass or abort")
+	}
+
+	return nil
+}
+
+func (s *sequenceStep) String() string {
+	switch s.kind {
+	case stepError:
+		return s.err.String()
+
+	case stepDelay:
+		return fmt.Sprintf("delay %s", s.delay)
+
+	case stepAbort:
+		return fmt.Sprintf("abort %s", s.abort)
+	}
+
+	return s.kind
+}
+
+func (s *sequenceSpec) UnmarshalJSON(data []byte) error {
+	sequenceSpec := struct {
+		Steps []*sequenceStep `json:"steps"`
+		Loop  bool            `json:"loop"`
+		Key   string          `json:"key"`
+		Name  string          `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(data, &sequenceSpec); err != nil {
+		return err
+	}
+
+	s.steps = sequenceSpec.Steps
+	s.loop = sequenceSpec.Loop
+	s.positions = make(map[string]int)
+
+	if len(s.steps) == 0 {
+		return fmt.Errorf("sequence steps parameter value must not be empty")
+	}
+
+	if sequenceSpec.Key != "" {
+		s.key = &samplingSpec{key: sequenceSpec.Key, name: sequenceSpec.Name}
+
+		if err := s.key.validate(); err != nil {
+			return fmt.Errorf("invalid value for sequence key parameter: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *sequenceSpec) String() string {
+	steps := make([]string, len(s.steps))
+	for i, step := range s.steps {
+		steps[i] = step.String()
+	}
+
+	desc := strings.Join(steps, ", ")
+
+	if s.loop {
+		desc += " (loop)"
+	}
+
+	if s.key != nil {
+		if s.key.key == "client_ip" {
+			desc += " per client IP"
+		} else {
+			desc += fmt.Sprintf(" per %s %s", s.key.key, s.key.name)
+		}
+	}
+
+	return desc
+}
+
+// next consumes the next step of the sequence of key, returning its index or false if the sequence is over.
+func (s *sequenceSpec) next(key string) (int, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	i, ok := s.positions[key]
+	if !ok && len(s.positions) >= maxSequenceKeys {
+		s.positions = make(map[string]int)
+	}
+
+	if i >= len(s.steps) {
+		if !s.loop {
+			return 0, false
+		}
+		i = 0
+	}
+	s.positions[key] = i + 1
+
+	return i, true
+}
+
+// state returns the number of tracked sequences and the position of the least advanced one.
+func (s *sequenceSpec) state() (int, int) {
+	s.Lock()
+	defer s.Unlock()
+
+	position := len(s.steps)
+	for _, i := range s.positions {
+		if i < position {
+			position = i
+		}
+	}
+
+	if len(s.positions) == 0 {
+		position = 0
+	}
+
+	return len(s.positions), position
+}
+
+// sequenceStep returns the index and the sequence step consumed by the HTTP request r, or nil if the spec doesn't
+// feature a sequence or if the sequence is over.
+func (s *spec) sequenceStep(r *http.Request) (int, *sequenceStep) {
+	if s.sequence == nil {
+		return 0, nil
+	}
+
+	var key string
+	if s.sequence.key != nil {
+		key, _ = s.sequence.key.value(r, s.xffDepth)
+	}
+
+	i, ok := s.sequence.next(key)
+	if !ok {
+		return 0, nil
+	}
+
+	return i, s.sequence.steps[i]
+}
@@ -0,0 +1,99 @@
+package chaos
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDR parses a source CIDR notation IP network, or a single IP address.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return network, nil
+}
+
+// clientIP returns the IP address of the client having sent the HTTP request r, trusting the depth last entries of
+// the X-Forwarded-For request header to have been appended by trusted proxies: if depth is 0 the request remote
+// address is used, if depth is 1 the last X-Forwarded-For entry is used and so on. It returns nil if the client
+// address cannot be determined.
+func clientIP(r *http.Request, depth int) net.IP {
+	var addrs []string
+
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	addrs = append(addrs, remoteAddr)
+
+	i := len(addrs) - 1 - depth
+	if i < 0 {
+		i = 0
+	}
+
+	return net.ParseIP(addrs[i])
+}
+
+// matchSource returns true if the client having sent the HTTP request r belongs to one of the networks.
+func matchSource(r *http.Request, networks []*net.IPNet, depth int) bool {
+	ip := clientIP(r, depth)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchHost returns true if the HTTP request r Host matches one of the host patterns, either an exact host name or
+// a wildcard pattern matching any subdomain (e.g. "*.example.net"). Comparison is case-insensitive and ignores the
+// port.
+func matchHost(r *http.Request, patterns []string) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,21 +3,102 @@ package chaos
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
 type spec struct {
-	delay *delaySpec
-	err   *errorSpec
+	// Number of requests cancelled during a blocking injection, number of aborted connections, number of requests
+	// currently blackholed, number of blackholed requests released by client disconnection, number of requests
+	// currently in flight, number of overloaded requests, number of injections and number of injection decisions,
+	// must remain first fields to ensure 64-bit alignment required by atomic operations on 32-bit platforms.
+	cancelled    uint64
+	aborted      uint64
+	blackholed   int64
+	disconnected uint64
+	inFlight     int64
+	overloaded   uint64
+	injections   int64
+	decisions    uint64
 
-	until time.Time
+	methods   []string
+	path      *pathPattern
+	pathRegex *regexp.Regexp
+	match     *matchSpec
+
+	sourceCIDRs []*net.IPNet
+	xffDepth    int
+	hosts       []string
+
+	sampling *samplingSpec
+
+	delay      *delaySpec
+	err        *errorSpec
+	throttle   *throttleSpec
+	abort      *abortSpec
+	blackhole  *blackholeSpec
+	corruption *corruptionSpec
+
+	sequence *sequenceSpec
+
+	rateLimit   *rateLimitSpec
+	concurrency *concurrencySpec
+
+	requestMutation  *requestMutationSpec
+	responseMutation *responseMutationSpec
+
+	startAt  time.Time
+	until    time.Time
+	schedule *scheduleSpec
+	cycle    *cycleSpec
+
+	maxInjections  int64
+	intervalBudget *intervalBudgetSpec
+
+	seed   int64
+	seeded bool
 }
 
 func (s *spec) UnmarshalJSON(data []byte) error {
 	chaosSpec := struct {
-		Delay    *delaySpec `json:"delay,omitempty"`
-		Error    *errorSpec `json:"error,omitempty"`
-		Duration string     `json:"duration,omitempty"`
+		Delay      *delaySpec      `json:"delay,omitempty"`
+		Error      *errorSpec      `json:"error,omitempty"`
+		Throttle   *throttleSpec   `json:"throttle,omitempty"`
+		Abort      *abortSpec      `json:"abort,omitempty"`
+		Blackhole  *blackholeSpec  `json:"blackhole,omitempty"`
+		Corruption *corruptionSpec `json:"corruption,omitempty"`
+
+		Sequence *sequenceSpec `json:"sequence,omitempty"`
+
+		RateLimit   *rateLimitSpec   `json:"rate_limit,omitempty"`
+		Concurrency *concurrencySpec `json:"concurrency,omitempty"`
+
+		RequestMutation  *requestMutationSpec  `json:"request_mutation,omitempty"`
+		ResponseMutation *responseMutationSpec `json:"response_mutation,omitempty"`
+
+		Duration string        `json:"duration,omitempty"`
+		StartAt  string        `json:"start_at,omitempty"`
+		EndAt    string        `json:"end_at,omitempty"`
+		Schedule *scheduleSpec `json:"schedule,omitempty"`
+		Cycle    *cycleSpec    `json:"cycle,omitempty"`
+
+		MaxInjections            int64               `json:"max_injections,omitempty"`
+		MaxInjectionsPerInterval *intervalBudgetSpec `json:"max_injections_per_interval,omitempty"`
+
+		Seed *int64 `json:"seed,omitempty"`
+
+		PathRegex string     `json:"path_regex,omitempty"`
+		Match     *matchSpec `json:"match,omitempty"`
+
+		SourceCIDRs []string `json:"source_cidrs,omitempty"`
+		XFFDepth    int      `json:"xff_depth,omitempty"`
+		Hosts       []string `json:"hosts,omitempty"`
+
+		Sampling *samplingSpec `json:"sampling,omitempty"`
 	}{}
 
 	if err := json.Unmarshal(data, &chaosSpec); err != nil {
@@ -26,6 +107,75 @@ func (s *spec) UnmarshalJSON(data []byte) error {
 
 	s.delay = chaosSpec.Delay
 	s.err = chaosSpec.Error
+	s.throttle = chaosSpec.Throttle
+	s.abort = chaosSpec.Abort
+	s.blackhole = chaosSpec.Blackhole
+	s.corruption = chaosSpec.Corruption
+	s.sequence = chaosSpec.Sequence
+	s.rateLimit = chaosSpec.RateLimit
+	s.concurrency = chaosSpec.Concurrency
+	s.requestMutation = chaosSpec.RequestMutation
+	s.responseMutation = chaosSpec.ResponseMutation
+	s.match = chaosSpec.Match
+	s.xffDepth = chaosSpec.XFFDepth
+	s.sampling = chaosSpec.Sampling
+
+	if chaosSpec.Seed != nil {
+		s.seed = *chaosSpec.Seed
+		s.seeded = true
+	}
+
+	for _, cidr := range chaosSpec.SourceCIDRs {
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid value for source_cidrs parameter: %s", err)
+		}
+
+		s.sourceCIDRs = append(s.sourceCIDRs, network)
+	}
+
+	if s.xffDepth < 0 {
+		return fmt.Errorf("xff_depth parameter value must be greater than or equal to 0")
+	}
+
+	for _, host := range chaosSpec.Hosts {
+		if host == "" {
+			return fmt.Errorf("hosts parameter values must not be empty")
+		}
+
+		s.hosts = append(s.hosts, strings.ToLower(host))
+	}
+
+	if chaosSpec.PathRegex != "" {
+		re, err := regexp.Compile(chaosSpec.PathRegex)
+		if err != nil {
+			return fmt.Errorf("invalid value for path_regex parameter: %s", err)
+		}
+
+		s.pathRegex = re
+	}
+
+	s.schedule = chaosSpec.Schedule
+	s.cycle = chaosSpec.Cycle
+	s.maxInjections = chaosSpec.MaxInjections
+	s.intervalBudget = chaosSpec.MaxInjectionsPerInterval
+
+	if s.maxInjections < 0 {
+		return fmt.Errorf("max_injections parameter value must be positive")
+	}
+
+	if chaosSpec.StartAt != "" {
+		startAt, err := time.Parse(time.RFC3339, chaosSpec.StartAt)
+		if err != nil {
+			return fmt.Errorf("invalid value for start_at parameter: %s", err)
+		}
+
+		s.startAt = startAt
+	}
+
+	if chaosSpec.Duration != "" && chaosSpec.EndAt != "" {
+		return fmt.Errorf("duration and end_at parameters are mutually exclusive")
+	}
 
 	if chaosSpec.Duration != "" {
 		duration, err := time.ParseDuration(chaosSpec.Duration)
@@ -33,8 +183,172 @@ func (s *spec) UnmarshalJSON(data []byte) error {
 			return fmt.Errorf("invalid value for duration parameter: %s", err)
 		}
 
-		s.until = time.Now().Add(duration)
+		// The duration is relative to the start time if set, or to now otherwise.
+		if s.startAt.IsZero() {
+			s.until = time.Now().Add(duration)
+		} else {
+			s.until = s.startAt.Add(duration)
+		}
+
+		// A spec ending in the past would never be enforced.
+		if !s.until.After(time.Now()) {
+			return fmt.Errorf("duration parameter value must end the spec in the future")
+		}
+	}
+
+	// Ramps and cycles start along with the spec effects.
+	start := time.Now()
+	if !s.startAt.IsZero() {
+		start = s.startAt
+	}
+
+	if s.delay != nil && s.delay.ramp != nil {
+		s.delay.ramp.start = start
+	}
+
+	if s.err != nil && s.err.ramp != nil {
+		s.err.ramp.start = start
+	}
+
+	if s.cycle != nil {
+		s.cycle.start = start
+	}
+
+	if chaosSpec.EndAt != "" {
+		endAt, err := time.Parse(time.RFC3339, chaosSpec.EndAt)
+		if err != nil {
+			return fmt.Errorf("invalid value for end_at parameter: %s", err)
+		}
+
+		if !endAt.After(s.startAt) {
+			return fmt.Errorf("end_at parameter value must be after start_at")
+		}
+
+		// A spec ending in the past would never be enforced.
+		if !endAt.After(time.Now()) {
+			return fmt.Errorf("end_at parameter value must be in the future")
+		}
+
+		s.until = endAt
 	}
 
 	return nil
 }
+
+// matches returns true if the spec targets the HTTP request r.
+func (s *spec) matches(r *http.Request) bool {
+	if len(s.methods) > 0 {
+		i := sort.SearchStrings(s.methods, r.Method)
+		if i == len(s.methods) || s.methods[i] != r.Method {
+			return false
+		}
+	}
+
+	if s.pathRegex != nil {
+		if !s.pathRegex.MatchString(r.URL.Path) {
+			return false
+		}
+	} else if !s.path.match(r.URL.Path) {
+		return false
+	}
+
+	if len(s.hosts) > 0 && !matchHost(r, s.hosts) {
+		return false
+	}
+
+	if len(s.sourceCIDRs) > 0 && !matchSource(r, s.sourceCIDRs, s.xffDepth) {
+		return false
+	}
+
+	return s.match == nil || s.match.matches(r)
+}
+
+// moreSpecific returns true if the spec takes precedence over spec o when both match a given request. Path patterns
+// take precedence over regular expressions, then specs are ordered by path pattern specificity, then by number of
+// methods (any method wildcard coming last). Remaining ties are broken by lexical order of the spec route keys to
+// keep the resolution deterministic.
+func (s *spec) moreSpecific(o *spec) bool {
+	switch {
+	case s.pathRegex == nil && o.pathRegex == nil:
+		if c := s.path.compare(o.path); c != 0 {
+			return c > 0
+		}
+
+	case s.pathRegex == nil || o.pathRegex == nil:
+		return s.pathRegex == nil
+	}
+
+	if len(s.methods) != len(o.methods) {
+		return len(o.methods) == 0 || (len(s.methods) > 0 && len(s.methods) < len(o.methods))
+	}
+
+	return s.key() < o.key()
+}
+
+// captures returns the values of the named capture groups of the spec path regular expression matching the URL path
+// of the HTTP request r, or nil if the spec route selector isn't a regular expression.
+func (s *spec) captures(r *http.Request) map[string]string {
+	if s.pathRegex == nil {
+		return nil
+	}
+
+	m := s.pathRegex.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return nil
+	}
+
+	captures := make(map[string]string)
+	for i, name := range s.pathRegex.SubexpNames() {
+		if name != "" {
+			captures[name] = m[i]
+		}
+	}
+
+	return captures
+}
+
+// reportCaptures reports the named capture groups values captures in the response written to rw, in the order of the
+// spec path regular expression.
+func (s *spec) reportCaptures(rw http.ResponseWriter, captures map[string]string) {
+	if len(captures) == 0 {
+		return
+	}
+
+	var values []string
+	for _, name := range s.pathRegex.SubexpNames() {
+		if v, ok := captures[name]; ok && name != "" {
+			values = append(values, name+"="+v)
+		}
+	}
+
+	rw.Header().Set("X-Chaos-Injected-Captures", strings.Join(values, ", "))
+}
+
+// key returns the spec route key, identifying the spec in the controller routes.
+func (s *spec) key() string {
+	return formatMethods(s.methods) + s.selector()
+}
+
+// target returns the description of the spec target route.
+func (s *spec) target() string {
+	return formatMethods(s.methods) + " " + s.selector()
+}
+
+// selector returns the spec route selector, i.e. either the path pattern or the path regular expression prefixed
+// with "~".
+func (s *spec) selector() string {
+	if s.pathRegex != nil {
+		return selector("", s.pathRegex.String())
+	}
+
+	return s.path.raw
+}
+
+// selector returns the route selector corresponding to either a path pattern or a path regular expression.
+func selector(path, pathRegex string) string {
+	if pathRegex != "" {
+		return "~" + pathRegex
+	}
+
+	return path
+}
@@ -0,0 +1,138 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Default size of the response chunks written when throttling is only based on inter-chunk delay.
+const defaultThrottleChunkSize = 1024
+
+type throttleSpec struct {
+	bps         int
+	chunkSize   int
+	chunkDelay  time.Duration
+	probability float64
+}
+
+func (s *throttleSpec) UnmarshalJSON(data []byte) error {
+	throttleSpec := struct {
+		BPS         int     `json:"bps"`
+		ChunkSize   int     `json:"chunk_size"`
+		ChunkDelay  int     `json:"chunk_delay"`
+		Probability float64 `json:"p"`
+	}{}
+
+	if err := json.Unmarshal(data, &throttleSpec); err != nil {
+		return err
+	}
+
+	s.bps = throttleSpec.BPS
+	s.chunkSize = throttleSpec.ChunkSize
+	s.chunkDelay = time.Duration(throttleSpec.ChunkDelay) * time.Millisecond
+	s.probability = throttleSpec.Probability
+
+	if s.bps < 0 || s.chunkSize < 0 || s.chunkDelay < 0 {
+		return fmt.Errorf("throttle bps, chunk_size and chunk_delay parameter values must be positive")
+	}
+
+	if s.bps == 0 && s.chunkDelay == 0 {
+		return fmt.Errorf("throttle bps or chunk_delay parameter value must be greater than 0 ")
+	}
+
+	if s.chunkSize == 0 {
+		switch {
+		case s.bps >= 10:
+			// Write chunks at a 100ms interval by default to smooth out the throughput.
+			s.chunkSize = s.bps / 10
+
+		case s.bps > 0:
+			s.chunkSize = 1
+
+		default:
+			s.chunkSize = defaultThrottleChunkSize
+		}
+	}
+
+	if s.probability < 0 || s.probability > 1 {
+		return fmt.Errorf("probability parameter value must be 0 < p < 1 ")
+	}
+
+	return nil
+}
+
+func (s *throttleSpec) String() string {
+	desc := fmt.Sprintf("%d B chunks", s.chunkSize)
+
+	if s.bps > 0 {
+		desc = fmt.Sprintf("%d B/s, ", s.bps) + desc
+	}
+
+	if s.chunkDelay > 0 {
+		desc += fmt.Sprintf(", %s chunk delay", s.chunkDelay)
+	}
+
+	return desc
+}
+
+func (s *spec) injectThrottle(r *http.Request, rnd *rand.Rand) bool {
+	return s.throttle != nil && s.sample(r, rnd, "throttle", s.throttle.probability)
+}
+
+// throttledResponseWriter is a http.ResponseWriter slowly dripping the response body written by the downstream
+// handler to the client, in chunks paced according to the throttle bandwidth and inter-chunk delay.
+type throttledResponseWriter struct {
+	http.ResponseWriter
+
+	spec *spec
+	r    *http.Request
+}
+
+func newThrottledResponseWriter(rw http.ResponseWriter, r *http.Request, spec *spec) *throttledResponseWriter {
+	return &throttledResponseWriter{
+		ResponseWriter: rw,
+		spec:           spec,
+		r:              r,
+	}
+}
+
+func (w *throttledResponseWriter) Write(data []byte) (int, error) {
+	var written int
+
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > w.spec.throttle.chunkSize {
+			chunk = chunk[:w.spec.throttle.chunkSize]
+		}
+		data = data[len(chunk):]
+
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		flush(w.ResponseWriter)
+
+		pause := w.spec.throttle.chunkDelay
+		if w.spec.throttle.bps > 0 {
+			pause += time.Duration(len(chunk)) * time.Second / time.Duration(w.spec.throttle.bps)
+		}
+
+		if _, err := w.spec.wait(w.r, pause); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+func (w *throttledResponseWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+func (w *throttledResponseWriter) finish() {
+	finishResponse(w.ResponseWriter)
+}
@@ -0,0 +1,26 @@
+package chaos
+
+import (
+	"net/http"
+)
+
+// responseFinisher is implemented by the http.ResponseWriter wrappers injecting chaos in the response phase that
+// need to complete the response once the downstream handler has returned. Implementations wrapping another
+// responseFinisher must finish it in turn.
+type responseFinisher interface {
+	finish()
+}
+
+// finishResponse completes the response written to rw if it is a responseFinisher.
+func finishResponse(rw http.ResponseWriter) {
+	if f, ok := rw.(responseFinisher); ok {
+		f.finish()
+	}
+}
+
+// flush flushes the buffered data of rw to the client if it implements http.Flusher.
+func flush(rw http.ResponseWriter) {
+	if f, ok := rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}